@@ -0,0 +1,147 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cachetest"
+)
+
+// openTestBolt opens a bbolt database at path, closed when the test ends.
+func openTestBolt(t *testing.T, path string) *bolt.DB {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+// newTestBoltCache creates a cache over a fresh bbolt database.
+func newTestBoltCache(t *testing.T, opts ...BoltOption) *BoltCacheAdapter {
+	t.Helper()
+
+	c, err := NewBoltCache(openTestBolt(t, t.TempDir()+"/counters.db"), opts...)
+	if err != nil {
+		t.Fatalf("NewBoltCache: %v", err)
+	}
+
+	return c
+}
+
+func TestBoltConformance(t *testing.T) {
+	for name, opts := range map[string][]BoltOption{
+		"Update": nil,
+		"Batch":  {WithBoltBatch(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestBoltCache(t, opts...)
+
+			cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+				return c
+			})
+		})
+	}
+}
+
+func TestBoltPersistsCounters(t *testing.T) {
+	path := t.TempDir() + "/counters.db"
+	ctx := context.Background()
+
+	db := openTestBolt(t, path)
+	c, err := NewBoltCache(db)
+	if err != nil {
+		t.Fatalf("NewBoltCache: %v", err)
+	}
+	if _, err := c.Increment(ctx, "key", time.Hour); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close database: %v", err)
+	}
+
+	c, err = NewBoltCache(openTestBolt(t, path))
+	if err != nil {
+		t.Fatalf("NewBoltCache: %v", err)
+	}
+	if count, err := c.Increment(ctx, "key", time.Hour); err != nil || count != 2 {
+		t.Fatalf("Increment after reopening = %d, %v, want 2", count, err)
+	}
+}
+
+func TestBoltDeleteExpired(t *testing.T) {
+	c := newTestBoltCache(t)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, err := c.Increment(ctx, "short", time.Second); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if _, err := c.Increment(ctx, "long", time.Hour); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	deleted, err := c.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d counters, want 1", deleted)
+	}
+
+	// Счётчик действующего окна не должен был пострадать
+	if count, err := c.Increment(ctx, "long", time.Hour); err != nil || count != 2 {
+		t.Fatalf("Increment(long) = %d, %v, want 2", count, err)
+	}
+}
+
+func TestBoltRunCleanup(t *testing.T) {
+	c := newTestBoltCache(t)
+
+	if _, err := c.Increment(context.Background(), "key", time.Millisecond); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.RunCleanup(ctx, time.Millisecond, func(err error) { t.Errorf("cleanup: %v", err) })
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		var stored bool
+		if err := c.db.View(func(tx *bolt.Tx) error {
+			stored = tx.Bucket(c.bucket).Get([]byte("key")) != nil
+			return nil
+		}); err != nil {
+			t.Fatalf("read counter: %v", err)
+		}
+		if !stored {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired counter was not deleted by RunCleanup")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunCleanup did not return after ctx was canceled")
+	}
+}
@@ -0,0 +1,144 @@
+package adapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcachedMaxKeyLength is the maximum key length accepted by memcached.
+const memcachedMaxKeyLength = 250
+
+// memcachedMaxRelativeExpiration is the longest expiration memcached
+// interprets as relative; longer ones must be absolute Unix timestamps.
+const memcachedMaxRelativeExpiration = 30 * 24 * time.Hour
+
+// memcachedMaxAttempts bounds the add/incr retries of a single increment.
+const memcachedMaxAttempts = 3
+
+// MemcachedCacheAdapter implements the Cache interface using memcached.
+//
+// The first increment of a window creates the key with `add`, which sets
+// its expiration and fails if the key already exists; later increments
+// use `incr`, which never modifies the expiration, ensuring fixed-window
+// behavior. Both commands are atomic on the server.
+//
+// Memcached expirations have a resolution of one second, so windows
+// are rounded up to whole seconds. The remaining TTL cannot be read back,
+// so the adapter does not implement TTLCache, and IncrementBy (CostCache)
+// reports the full window as the time left.
+//
+// Keys longer than 250 bytes or containing spaces or control characters
+// are replaced with their SHA-256 digest.
+//
+// The memcache client does not support contexts: ctx is only checked
+// before the call, and timeouts are governed by the client's Timeout.
+type MemcachedCacheAdapter struct {
+	client *memcache.Client
+	now    func() time.Time
+}
+
+// NewMemcachedCache creates a memcached-backed Cache implementation.
+func NewMemcachedCache(client *memcache.Client) *MemcachedCacheAdapter {
+	return &MemcachedCacheAdapter{
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Increment atomically increments the counter for the given key.
+//
+// The expiration is set only by the `add` that creates the key
+// and is not extended by subsequent `incr` calls.
+func (c *MemcachedCacheAdapter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, _, err := c.IncrementBy(ctx, key, 1, ttl)
+	return count, err
+}
+
+// IncrementBy atomically increments the counter for the given key by cost,
+// creating it with `add` and the value cost or adding cost with `incr`.
+//
+// The time left until the key expires cannot be read back from memcached,
+// so the full window is returned instead: an upper bound of the actual TTL.
+func (c *MemcachedCacheAdapter) IncrementBy(ctx context.Context, key string, cost int64, ttl time.Duration) (int64, time.Duration, error) {
+	if cost < 0 {
+		return 0, 0, fmt.Errorf("increment %q: negative cost %d", key, cost)
+	}
+
+	key = memcachedKey(key)
+
+	for attempt := 0; attempt < memcachedMaxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		err := c.client.Add(&memcache.Item{
+			Key:        key,
+			Value:      []byte(strconv.FormatInt(cost, 10)),
+			Expiration: c.expiration(ttl),
+		})
+		if err == nil {
+			return cost, ttl, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return 0, 0, fmt.Errorf("add: %w", err)
+		}
+
+		count, err := c.client.Increment(key, uint64(cost))
+		if err == nil {
+			return int64(count), ttl, nil
+		}
+		// Ключ истёк между add и incr — начинаем новое окно
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, 0, fmt.Errorf("incr: %w", err)
+		}
+	}
+
+	return 0, 0, fmt.Errorf("increment %q: key expired during %d attempts", key, memcachedMaxAttempts)
+}
+
+// expiration converts a window into a memcached expiration,
+// rounded up to whole seconds.
+func (c *MemcachedCacheAdapter) expiration(ttl time.Duration) int32 {
+	seconds := max(1, int64((ttl+time.Second-1)/time.Second))
+
+	if time.Duration(seconds)*time.Second > memcachedMaxRelativeExpiration {
+		return int32(c.now().Unix() + seconds)
+	}
+
+	return int32(seconds)
+}
+
+// memcachedKey returns the key unchanged if memcached accepts it,
+// or its hex-encoded SHA-256 digest otherwise.
+func memcachedKey(key string) string {
+	if isMemcachedKey(key) {
+		return key
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return "rate-limiter:" + hex.EncodeToString(sum[:])
+}
+
+// isMemcachedKey reports whether memcached accepts the key: at most
+// 250 bytes without spaces, control characters or DEL.
+func isMemcachedKey(key string) bool {
+	if len(key) > memcachedMaxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
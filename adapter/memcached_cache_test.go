@@ -0,0 +1,257 @@
+package adapter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cachetest"
+)
+
+// fakeMemcached is an in-process server speaking the part of the
+// memcached text protocol used by the adapter: add and incr.
+type fakeMemcached struct {
+	addr string
+
+	mu    sync.Mutex
+	items map[string]*fakeMemcachedItem
+	// incrMisses is the number of upcoming incr commands answered with
+	// NOT_FOUND, as if the key expired and another client re-created it.
+	incrMisses int
+}
+
+type fakeMemcachedItem struct {
+	value    uint64
+	expireAt time.Time
+}
+
+// newFakeMemcached starts a fake memcached server for the test.
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &fakeMemcached{
+		addr:  ln.Addr().String(),
+		items: make(map[string]*fakeMemcachedItem),
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+// client returns a memcache client connected to the server.
+func (s *fakeMemcached) client() *memcache.Client {
+	client := memcache.New(s.addr)
+	client.MaxIdleConns = cachetest.Concurrency
+
+	return client
+}
+
+func (s *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch fields := strings.Fields(line); {
+		case len(fields) == 5 && fields[0] == "add":
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			exptime, _ := strconv.ParseInt(fields[3], 10, 64)
+			value, _ := strconv.ParseUint(string(data[:size]), 10, 64)
+			reply = s.add(fields[1], value, exptime)
+		case len(fields) == 3 && fields[0] == "incr":
+			delta, _ := strconv.ParseUint(fields[2], 10, 64)
+			reply = s.incr(fields[1], delta)
+		default:
+			reply = "ERROR"
+		}
+
+		if _, err := fmt.Fprintf(conn, "%s\r\n", reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeMemcached) add(key string, value uint64, exptime int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.get(key) != nil {
+		return "NOT_STORED"
+	}
+
+	// Как и memcached, считаем срок больше 30 дней абсолютным Unix-временем
+	expireAt := time.Now().Add(time.Duration(exptime) * time.Second)
+	if time.Duration(exptime)*time.Second > memcachedMaxRelativeExpiration {
+		expireAt = time.Unix(exptime, 0)
+	}
+	s.items[key] = &fakeMemcachedItem{value: value, expireAt: expireAt}
+
+	return "STORED"
+}
+
+func (s *fakeMemcached) incr(key string, delta uint64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.get(key)
+	if item == nil || s.incrMisses > 0 {
+		s.incrMisses = max(0, s.incrMisses-1)
+		return "NOT_FOUND"
+	}
+	item.value += delta
+
+	return strconv.FormatUint(item.value, 10)
+}
+
+// get returns the live item stored under key. Must be called with s.mu held.
+func (s *fakeMemcached) get(key string) *fakeMemcachedItem {
+	item, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(item.expireAt) {
+		delete(s.items, key)
+		return nil
+	}
+
+	return item
+}
+
+func TestMemcachedConformance(t *testing.T) {
+	c := NewMemcachedCache(newFakeMemcached(t).client())
+
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		return c
+	}, cachetest.WithWindow(2*time.Second))
+}
+
+// TestMemcachedIncrementRetries checks the add/incr retry loop
+// when the key expires between the two commands.
+func TestMemcachedIncrementRetries(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache(server.client())
+	ctx := context.Background()
+
+	if count, err := c.Increment(ctx, "key", time.Minute); err != nil || count != 1 {
+		t.Fatalf("first Increment = %d, %v, want 1", count, err)
+	}
+
+	server.mu.Lock()
+	server.incrMisses = memcachedMaxAttempts - 1
+	server.mu.Unlock()
+
+	if count, err := c.Increment(ctx, "key", time.Minute); err != nil || count != 2 {
+		t.Fatalf("Increment after %d misses = %d, %v, want 2", memcachedMaxAttempts-1, count, err)
+	}
+
+	server.mu.Lock()
+	server.incrMisses = memcachedMaxAttempts
+	server.mu.Unlock()
+
+	if _, err := c.Increment(ctx, "key", time.Minute); err == nil || !strings.Contains(err.Error(), "expired during") {
+		t.Fatalf("Increment after %d misses: got %v, want an expiry error", memcachedMaxAttempts, err)
+	}
+}
+
+// TestMemcachedIncrementBy checks that costs are added with the incr
+// delta, including after the key expired between add and incr,
+// and that the full window is reported as the time left.
+func TestMemcachedIncrementBy(t *testing.T) {
+	server := newFakeMemcached(t)
+	c := NewMemcachedCache(server.client())
+	ctx := context.Background()
+
+	steps := []struct {
+		cost       int64
+		incrMisses int
+		want       int64
+	}{
+		{cost: 3, want: 3},
+		{cost: 2, want: 5},
+		{cost: 4, incrMisses: 1, want: 9},
+		{cost: 0, want: 9},
+	}
+	for i, step := range steps {
+		server.mu.Lock()
+		server.incrMisses = step.incrMisses
+		server.mu.Unlock()
+
+		count, ttl, err := c.IncrementBy(ctx, "key", step.cost, time.Minute)
+		if err != nil || count != step.want || ttl != time.Minute {
+			t.Fatalf("IncrementBy #%d of %d = %d, %s, %v, want %d, %s", i+1, step.cost, count, ttl, err, step.want, time.Minute)
+		}
+	}
+
+	if _, _, err := c.IncrementBy(ctx, "key", -1, time.Minute); err == nil {
+		t.Fatal("IncrementBy with negative cost: want error")
+	}
+}
+
+// TestMemcachedLongWindow checks that windows over 30 days are sent
+// as absolute timestamps instead of expiring right away.
+func TestMemcachedLongWindow(t *testing.T) {
+	c := NewMemcachedCache(newFakeMemcached(t).client())
+	ctx := context.Background()
+
+	for want := int64(1); want <= 2; want++ {
+		if count, err := c.Increment(ctx, "key", 45*24*time.Hour); err != nil || count != want {
+			t.Fatalf("Increment = %d, %v, want %d", count, err, want)
+		}
+	}
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := &MemcachedCacheAdapter{now: func() time.Time { return now }}
+
+	tests := []struct {
+		ttl  time.Duration
+		want int32
+	}{
+		{ttl: 0, want: 1},
+		{ttl: 1500 * time.Millisecond, want: 2},
+		{ttl: time.Minute, want: 60},
+		{ttl: memcachedMaxRelativeExpiration, want: int32(memcachedMaxRelativeExpiration / time.Second)},
+		{ttl: memcachedMaxRelativeExpiration + time.Second, want: int32(now.Unix()) + int32(memcachedMaxRelativeExpiration/time.Second) + 1},
+	}
+
+	for _, tt := range tests {
+		if got := c.expiration(tt.ttl); got != tt.want {
+			t.Errorf("expiration(%s) = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+}
@@ -3,24 +3,59 @@ package adapter
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/samber/lo"
+
+	"github.com/murouse/rate-limiter/quota"
 )
 
 // RedisCacheAdapter implements the Cache interface using Redis.
 //
-// It relies on a Lua script to guarantee atomic increment
-// and fixed-window TTL semantics.
+// It relies on Lua scripts to guarantee atomic increment
+// with fixed-window TTL semantics (for one key, batched or
+// all-or-nothing for several keys), atomic token bucket refills,
+// atomic sliding window counter updates, atomic GCRA checks
+// and atomic sliding log updates.
+//
+// Scripts are compiled once per process, loaded into Redis on
+// construction and executed with EVALSHA, falling back to EVAL
+// when the server does not know the script (e.g. after a restart).
+//
+// Every call needs its reply right away, so pipelines (redis.Pipeliner)
+// are not supported; calls made through one fail with
+// ErrPipelineNotSupported.
 type RedisCacheAdapter struct {
 	client redis.Scripter
 }
 
 // NewRedisCache creates a Redis-backed Cache implementation.
 //
-// The provided client must support script execution (redis.Scripter).
+// The provided client must support script execution (redis.Scripter),
+// which includes every redis.UniversalClient (Client, ClusterClient,
+// Ring and failover clients).
+//
+// The scripts are loaded with SCRIPT LOAD before returning, waiting
+// at most one second. Loading is best effort: if Redis is unavailable,
+// scripts are sent with EVAL on first use.
 func NewRedisCache(client redis.Scripter) *RedisCacheAdapter {
-	return &RedisCacheAdapter{client: client}
+	c := &RedisCacheAdapter{client: client}
+	preloadScripts(client, redisScripts...)
+
+	return c
+}
+
+// LoadScripts loads all scripts into the Redis script cache with SCRIPT LOAD,
+// reporting failures.
+//
+// NewRedisCache already does so; call it to make sure the scripts are
+// loaded, e.g. when Redis was not reachable at construction. On Redis
+// Cluster the scripts are loaded on every master.
+func (c *RedisCacheAdapter) LoadScripts(ctx context.Context) error {
+	return loadScripts(ctx, c.client, redisScripts...)
 }
 
 // Increment atomically increments the counter for the given key.
@@ -28,28 +63,237 @@ func NewRedisCache(client redis.Scripter) *RedisCacheAdapter {
 // TTL is set only when the key is created (first increment)
 // and is not extended on subsequent calls, ensuring fixed-window behavior.
 func (c *RedisCacheAdapter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
-	script := redis.NewScript(`
-       local current = redis.call("INCR", KEYS[1])
-       if current == 1 then
-           redis.call("PEXPIRE", KEYS[1], ARGV[1])
-       end
-       return current
-   `)
-
-	res, err := script.Run(
+	count, _, err := c.IncrementBy(ctx, key, 1, ttl)
+	return count, err
+}
+
+// IncrementWithTTL behaves like Increment and additionally
+// returns the remaining TTL of the key (PTTL) read in the same script.
+func (c *RedisCacheAdapter) IncrementWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return c.IncrementBy(ctx, key, 1, ttl)
+}
+
+// IncrementBy behaves like IncrementWithTTL,
+// incrementing the counter by cost (INCRBY) instead of one.
+func (c *RedisCacheAdapter) IncrementBy(ctx context.Context, key string, cost int64, ttl time.Duration) (int64, time.Duration, error) {
+	res, err := runScript(
 		ctx,
 		c.client,
+		incrementScript,
 		[]string{key},
 		ttl.Milliseconds(),
-	).Result()
+		cost,
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected result length %d", len(res))
+	}
+
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// IncrementMulti increments every counter independently
+// in a single script, i.e. a single round trip to Redis.
+//
+// On Redis Cluster counters are grouped by hash slot and the script
+// runs once per slot, so keys sharing a hash tag still need a single
+// round trip.
+func (c *RedisCacheAdapter) IncrementMulti(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	if !isCluster(c.client) {
+		return c.runCounterScript(ctx, incrementMultiScript, counters)
+	}
+
+	groups := groupBySlot(lo.Map(counters, func(counter quota.Counter, _ int) string {
+		return counter.Key
+	}))
+	if len(groups) == 1 {
+		return c.runCounterScript(ctx, incrementMultiScript, counters)
+	}
+
+	results := make([]quota.Result, len(counters))
+	for _, group := range groups {
+		res, err := c.runCounterScript(ctx, incrementMultiScript, lo.Map(group, func(i int, _ int) quota.Counter {
+			return counters[i]
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range group {
+			results[i] = res[j]
+		}
+	}
+
+	return results, nil
+}
+
+// IncrementAll atomically increments all counters if every one of them
+// stays within its limit, and leaves all of them untouched otherwise.
+//
+// All counters are read and, if allowed, incremented in a single script,
+// so every key must hash to the same slot on Redis Cluster; ErrCrossSlot
+// is returned otherwise, without running the script.
+func (c *RedisCacheAdapter) IncrementAll(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	if isCluster(c.client) {
+		groups := groupBySlot(lo.Map(counters, func(counter quota.Counter, _ int) string {
+			return counter.Key
+		}))
+		if len(groups) > 1 {
+			return nil, ErrCrossSlot
+		}
+	}
+
+	return c.runCounterScript(ctx, incrementAllScript, counters)
+}
+
+// runCounterScript runs a multi-key counter script with one
+// {window, limit, cost} argument triple per counter and converts its flat
+// {allowed, remaining, retryAfter, resetAfter} reply into results.
+func (c *RedisCacheAdapter) runCounterScript(ctx context.Context, script *redis.Script, counters []quota.Counter) ([]quota.Result, error) {
+	keys := make([]string, 0, len(counters))
+	args := make([]any, 0, len(counters)*3)
+	for _, counter := range counters {
+		keys = append(keys, counter.Key)
+		args = append(args, counter.Window.Milliseconds(), counter.Limit, counter.Amount())
+	}
+
+	res, err := runScript(ctx, c.client, script, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) != len(counters)*4 {
+		return nil, fmt.Errorf("unexpected result length %d", len(res))
+	}
+
+	results := make([]quota.Result, 0, len(counters))
+	for i := 0; i < len(res); i += 4 {
+		r, err := resultFromScript(res[i:i+4], time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// TakeToken atomically refills the token bucket for the given key
+// and takes cost tokens from it if that many are available.
+//
+// The bucket is stored as a hash with the current token count and
+// the last refill timestamp taken from the Redis server clock (TIME),
+// so all instances share one time source. The key expires once the
+// bucket would be full again.
+func (c *RedisCacheAdapter) TakeToken(ctx context.Context, key string, cost, capacity int64, refillInterval time.Duration) (quota.Result, error) {
+	res, err := runScript(
+		ctx,
+		c.client,
+		takeTokenScript,
+		[]string{key},
+		capacity,
+		// Интервал короче микросекунды округляется вверх, иначе скрипт делит на ноль
+		max(1, refillInterval.Microseconds()),
+		cost,
+	).Int64Slice()
+	if err != nil {
+		return quota.Result{}, err
+	}
+
+	return resultFromScript(res, time.Microsecond)
+}
+
+// IncrementSliding atomically increments the current window counter
+// for the given key by cost and returns the weighted count of the current
+// and previous windows, along with the time until the current window ends.
+//
+// Both counts are kept in a single hash together with the current
+// window index, so the operation touches one key only. Windows are
+// aligned on the Redis server clock (TIME) and last at least a millisecond.
+func (c *RedisCacheAdapter) IncrementSliding(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error) {
+	res, err := runScript(
+		ctx,
+		c.client,
+		incrementSlidingScript,
+		[]string{key},
+		max(1, window.Milliseconds()),
+		cost,
+	).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected result length %d", len(res))
+	}
+
+	return res[0], time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// AllowGCRA atomically evaluates a request against the theoretical
+// arrival time (TAT) stored under the given key.
+//
+// Only a single integer (TAT in microseconds of the Redis server clock)
+// is stored per key, and it expires as soon as the TAT is in the past.
+// For rejected requests the exact time until the next allowed request
+// is returned.
+func (c *RedisCacheAdapter) AllowGCRA(ctx context.Context, key string, cost int64, emissionInterval time.Duration, burst int64) (quota.Result, error) {
+	res, err := runScript(
+		ctx,
+		c.client,
+		gcraScript,
+		[]string{key},
+		// Интервал короче микросекунды округляется вверх, иначе скрипт делит на ноль
+		max(1, emissionInterval.Microseconds()),
+		burst,
+		cost,
+	).Int64Slice()
+	if err != nil {
+		return quota.Result{}, err
+	}
+
+	return resultFromScript(res, time.Microsecond)
+}
+
+// AppendLog atomically evicts entries older than window from the sorted
+// set stored under the given key and adds cost entries scored with the
+// current Redis server time if that many free slots remain below limit.
+//
+// ZREMRANGEBYSCORE, ZCARD and ZADD run in a single script. For rejected
+// requests the time until enough entries leave the window is returned.
+func (c *RedisCacheAdapter) AppendLog(ctx context.Context, key string, cost, limit int64, window time.Duration) (quota.Result, error) {
+	res, err := runScript(
+		ctx,
+		c.client,
+		appendLogScript,
+		[]string{key},
+		max(1, window.Microseconds()),
+		limit,
+		// Уникальный префикс записей, чтобы одновременные запросы не перезаписывали друг друга
+		strconv.FormatUint(rand.Uint64(), 36),
+		cost,
+	).Int64Slice()
 	if err != nil {
-		return 0, err
+		return quota.Result{}, err
 	}
 
-	count, ok := res.(int64)
-	if !ok {
-		return 0, fmt.Errorf("unexpected type %T", res)
+	return resultFromScript(res, time.Microsecond)
+}
+
+// resultFromScript converts a {allowed, remaining, retryAfter, resetAfter}
+// script reply into a quota.Result, with durations expressed in unit.
+func resultFromScript(res []int64, unit time.Duration) (quota.Result, error) {
+	if len(res) != 4 {
+		return quota.Result{}, fmt.Errorf("unexpected result length %d", len(res))
 	}
 
-	return count, nil
+	return quota.Result{
+		Allowed:    res[0] == 1,
+		Remaining:  res[1],
+		RetryAfter: time.Duration(res[2]) * unit,
+		ResetAfter: time.Duration(res[3]) * unit,
+	}, nil
 }
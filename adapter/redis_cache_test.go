@@ -0,0 +1,326 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cachetest"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// newTestRedis starts an in-process Redis server for the test.
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return server, client
+}
+
+// fastForward advances the clock of the in-process Redis in real time
+// until the test ends: miniredis expires keys only when told to.
+func fastForward(t *testing.T, server *miniredis.Miniredis) {
+	t.Helper()
+
+	const step = 5 * time.Millisecond
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		ticker := time.NewTicker(step)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				server.FastForward(step)
+			}
+		}
+	}()
+}
+
+func TestRedisConformance(t *testing.T) {
+	server, client := newTestRedis(t)
+	fastForward(t, server)
+
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		return NewRedisCache(client)
+	})
+}
+
+func TestRedisAlgorithms(t *testing.T) {
+	cachetest.RunAlgorithms(t, func(t *testing.T) (ratelimiter.Cache, func(time.Duration)) {
+		server, client := newTestRedis(t)
+
+		// Скрипты читают время командой TIME, которую miniredis берёт из SetTime
+		now := time.Unix(1700000000, 0)
+		server.SetTime(now)
+
+		return NewRedisCache(client), func(d time.Duration) {
+			now = now.Add(d)
+			server.SetTime(now)
+		}
+	})
+}
+
+// TestSubMicrosecondIntervals checks that intervals shorter than the
+// resolution of the scripts are rounded up instead of producing
+// a division by zero in Lua.
+func TestSubMicrosecondIntervals(t *testing.T) {
+	_, client := newTestRedis(t)
+	c := NewRedisCache(client)
+	ctx := context.Background()
+
+	res, err := c.AllowGCRA(ctx, "gcra", 1, 100*time.Nanosecond, 5)
+	if err != nil {
+		t.Fatalf("AllowGCRA: %v", err)
+	}
+	if !res.Allowed || res.Remaining != 4 {
+		t.Fatalf("AllowGCRA = %+v, want allowed with 4 remaining", res)
+	}
+
+	res, err = c.TakeToken(ctx, "bucket", 1, 5, 100*time.Nanosecond)
+	if err != nil {
+		t.Fatalf("TakeToken: %v", err)
+	}
+	if !res.Allowed {
+		t.Fatalf("TakeToken = %+v, want allowed", res)
+	}
+
+	if _, _, err := c.IncrementSliding(ctx, "sliding", 1, 100*time.Microsecond); err != nil {
+		t.Fatalf("IncrementSliding: %v", err)
+	}
+}
+
+func TestNewRedisCacheLoadsScripts(t *testing.T) {
+	_, client := newTestRedis(t)
+	NewRedisCache(client)
+
+	hashes := make([]string, 0, len(redisScripts))
+	for _, script := range redisScripts {
+		hashes = append(hashes, script.Hash())
+	}
+
+	exists, err := client.ScriptExists(context.Background(), hashes...).Result()
+	if err != nil {
+		t.Fatalf("SCRIPT EXISTS: %v", err)
+	}
+	for i, ok := range exists {
+		if !ok {
+			t.Fatalf("script %s not loaded", hashes[i])
+		}
+	}
+}
+
+func TestPipelineNotSupported(t *testing.T) {
+	_, client := newTestRedis(t)
+	pipe := client.Pipeline()
+	c := NewRedisCache(pipe)
+
+	if _, _, err := c.IncrementWithTTL(context.Background(), "key", time.Minute); !errors.Is(err, ErrPipelineNotSupported) {
+		t.Fatalf("IncrementWithTTL through a pipeline: err = %v, want ErrPipelineNotSupported", err)
+	}
+	if err := c.LoadScripts(context.Background()); !errors.Is(err, ErrPipelineNotSupported) {
+		t.Fatalf("LoadScripts through a pipeline: err = %v, want ErrPipelineNotSupported", err)
+	}
+	if n := pipe.Len(); n != 0 {
+		t.Fatalf("%d commands queued in the caller's pipeline", n)
+	}
+}
+
+// stubReplyHook answers every command with a fixed reply without
+// contacting Redis, so benchmarks measure the adapter and the client only.
+type stubReplyHook struct {
+	reply []interface{}
+}
+
+func (h stubReplyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h stubReplyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if c, ok := cmd.(*redis.Cmd); ok {
+			c.SetVal(h.reply)
+		}
+		return nil
+	}
+}
+
+func (h stubReplyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// newStubCache creates an adapter whose client answers every script
+// with the given reply.
+func newStubCache(b *testing.B, reply ...interface{}) *RedisCacheAdapter {
+	b.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	client.AddHook(stubReplyHook{reply: reply})
+	b.Cleanup(func() { _ = client.Close() })
+
+	return &RedisCacheAdapter{client: client}
+}
+
+// BenchmarkRedisIncrementWithTTL reports the per-request allocations
+// of a fixed-window increment with the precompiled script.
+func BenchmarkRedisIncrementWithTTL(b *testing.B) {
+	c := newStubCache(b, int64(1), int64(60000))
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, err := c.IncrementWithTTL(ctx, "key", time.Minute); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRedisIncrementWithTTLScriptPerCall is the baseline of
+// BenchmarkRedisIncrementWithTTL: the script is created on every call,
+// re-hashing its source as the adapter used to.
+func BenchmarkRedisIncrementWithTTLScriptPerCall(b *testing.B) {
+	c := newStubCache(b, int64(1), int64(60000))
+	ctx := context.Background()
+	src := `
+		local current = redis.call("INCRBY", KEYS[1], ARGV[2])
+		if current == tonumber(ARGV[2]) then
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+		return {current, redis.call("PTTL", KEYS[1])}
+	`
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := redis.NewScript(src).Run(ctx, c.client, []string{"key"}, int64(60000), int64(1)).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRedisIncrementMulti reports the allocations of checking
+// three fixed-window rules in one round trip.
+func BenchmarkRedisIncrementMulti(b *testing.B) {
+	reply := make([]interface{}, 0, 12)
+	for range 3 {
+		reply = append(reply, int64(1), int64(9), int64(0), int64(60000))
+	}
+	c := newStubCache(b, reply...)
+	ctx := context.Background()
+	counters := []quota.Counter{
+		{Key: "a", Window: time.Second, Limit: 10},
+		{Key: "b", Window: time.Minute, Limit: 10},
+		{Key: "c", Window: time.Hour, Limit: 10},
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := c.IncrementMulti(ctx, counters); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestIncrementAllCrossSlot checks that IncrementAll refuses counters
+// spanning several Redis Cluster slots with a configuration error.
+func TestIncrementAllCrossSlot(t *testing.T) {
+	server, _ := newTestRedis(t)
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+	t.Cleanup(func() { _ = client.Close() })
+
+	cache := NewRedisCache(client)
+	counters := []quota.Counter{
+		{Key: "rate-limiter:{a}:per_minute", Window: time.Minute, Limit: 10},
+		{Key: "rate-limiter:{b}:per_minute", Window: time.Minute, Limit: 10},
+	}
+
+	_, err := cache.IncrementAll(context.Background(), counters)
+	if !errors.Is(err, ErrCrossSlot) || !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("got %v, want ErrCrossSlot wrapping errors.ErrUnsupported", err)
+	}
+}
+
+// TestAllOrNothingRuleKeysOnCluster checks that rules of one method
+// selecting different key parts are rejected as misconfigured on Redis
+// Cluster rather than handled as a Redis outage.
+func TestAllOrNothingRuleKeysOnCluster(t *testing.T) {
+	server, _ := newTestRedis(t)
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{server.Addr()}})
+	t.Cleanup(func() { _ = client.Close() })
+
+	rl := ratelimiter.New(
+		ratelimiter.WithCache(NewRedisCache(client)),
+		ratelimiter.WithAllOrNothing(true),
+		ratelimiter.WithFailurePolicy(ratelimiter.FailurePolicyFailOpen),
+		ratelimiter.WithGlobalLimitRules([]ratelimiter.Rule{
+			{Name: "per_user", Limit: 10, Window: time.Minute, Key: &ratelimiter.RuleKey{Extension: true}},
+			{Name: "per_method", Limit: 100, Window: time.Minute, Key: &ratelimiter.RuleKey{}},
+		}),
+	)
+	t.Cleanup(func() { _ = rl.Close() })
+
+	_, err := rl.UnaryServerInterceptor()(
+		context.Background(),
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+	)
+	if status.Code(err) != codes.Internal || !strings.Contains(status.Convert(err).Message(), ErrCrossSlot.Error()) {
+		t.Fatalf("got %v, want Internal caused by ErrCrossSlot", err)
+	}
+}
+
+// TestOversizedCostRejected checks that the token bucket and GCRA
+// scripts reject requests costing more than the bucket or burst
+// with a positive retry delay.
+func TestOversizedCostRejected(t *testing.T) {
+	_, client := newTestRedis(t)
+	c := NewRedisCache(client)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		res, err := c.AllowGCRA(ctx, "gcra", 200000, 24*time.Hour, 1)
+		if err != nil {
+			t.Fatalf("AllowGCRA: %v", err)
+		}
+		if res.Allowed || res.RetryAfter != 24*time.Hour {
+			t.Fatalf("AllowGCRA #%d = %+v, want rejected with retry after 24h", i+1, res)
+		}
+	}
+
+	res, err := c.TakeToken(ctx, "bucket", math.MaxInt32, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("TakeToken: %v", err)
+	}
+	if res.Allowed || res.RetryAfter != 10*time.Hour || res.ResetAfter < 0 {
+		t.Fatalf("TakeToken = %+v, want rejected with retry after 10h", res)
+	}
+
+	// Время наполнения бакета не помещается в int64 микросекунд и ограничивается сверху
+	res, err = c.TakeToken(ctx, "bucket-long", math.MaxInt32, 1_000_000_000, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("TakeToken: %v", err)
+	}
+	if maxDelay := time.Duration(1<<53) * time.Microsecond; res.Allowed || res.RetryAfter != maxDelay {
+		t.Fatalf("TakeToken with a huge refill time = %+v, want rejected with retry after %s", res, maxDelay)
+	}
+}
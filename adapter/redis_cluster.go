@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisClusterSlots is the number of hash slots in Redis Cluster.
+const redisClusterSlots = 16384
+
+// ErrCrossSlot is returned when an atomic multi-key operation
+// spans several Redis Cluster hash slots.
+//
+// It reports rules that cannot be stored together on Redis Cluster
+// rather than a storage failure, so it wraps errors.ErrUnsupported:
+// the limiter rejects the request regardless of the failure policy
+// and the circuit breaker does not count it.
+var ErrCrossSlot = fmt.Errorf("keys of an atomic operation must hash to the same slot: %w", errors.ErrUnsupported)
+
+// isCluster reports whether the client talks to Redis Cluster.
+func isCluster(client redis.Scripter) bool {
+	_, ok := client.(*redis.ClusterClient)
+	return ok
+}
+
+// hashSlot returns the Redis Cluster hash slot of the given key.
+//
+// If the key contains a non-empty hash tag ({...}), only the tag is hashed.
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// groupBySlot returns the indexes of the given keys grouped by hash slot,
+// preserving the order of first appearance of every slot.
+func groupBySlot(keys []string) [][]int {
+	var groups [][]int
+	slots := make(map[int]int)
+
+	for i, key := range keys {
+		slot := hashSlot(key)
+
+		group, ok := slots[slot]
+		if !ok {
+			group = len(groups)
+			slots[slot] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	return groups
+}
+
+// crc16 implements CRC16-CCITT (XModem), as used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,370 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// DefaultLeaseSize is the default number of units leased from Redis at once.
+const DefaultLeaseSize = 50
+
+// leaseSweepInterval is the minimum interval between sweeps of expired leases.
+const leaseSweepInterval = time.Minute
+
+// leaseQuotaShare bounds a lease taken by Reserve to 1/leaseQuotaShare
+// of the units left in the window, so leases shrink as the limit nears.
+const leaseQuotaShare = 10
+
+// RedisLeaseCacheAdapter implements the Cache and QuotaCache interfaces
+// on top of Redis, serving requests from chunks of quota leased per key.
+//
+// Each lease atomically takes a number of units from the Redis counter
+// (TTL set on creation only) for this instance. Requests are then served
+// locally from the lease, so a key costs one Redis round trip per lease
+// instead of one per request.
+//
+// Reserve leases against the limit of the rule: a lease takes at most
+// the lease size and at most 1/10 of the units left in the window, and
+// no units at all once fewer than needed are left. Units left in a lease
+// that cannot serve the next request are given back with the next lease,
+// and Release gives back the rest on shutdown. The limit is thus never
+// exceeded; the trade-off is early rejection while other instances hold
+// unused units, at most one lease per instance.
+//
+// Increment and IncrementBy know no limit and return counts unique
+// across instances; their unused units are discarded with the window.
+type RedisLeaseCacheAdapter struct {
+	client    redis.Scripter
+	leaseSize int64
+	now       func() time.Time
+
+	mu        sync.Mutex
+	leases    map[string]*lease
+	lastSweep time.Time
+}
+
+// lease is a range of counts reserved by this instance for one key.
+type lease struct {
+	mu       sync.Mutex
+	next     int64 // следующий выдаваемый счётчик
+	last     int64 // последний счётчик, входящий в аренду
+	expireAt time.Time
+	window   string // идентификатор окна, в котором взята аренда
+	reserved bool   // аренда взята Reserve, и её остаток можно вернуть
+}
+
+// live reports whether the window of the lease has not ended yet.
+func (l *lease) live(now time.Time) bool {
+	return now.Before(l.expireAt)
+}
+
+// left returns the number of units left in the lease.
+func (l *lease) left() int64 {
+	return l.last - l.next + 1
+}
+
+// leaseRequest describes a call of the lease script.
+type leaseRequest struct {
+	ttl   time.Duration
+	size  int64 // желаемый размер аренды
+	need  int64 // минимальный размер аренды
+	limit int64 // лимит окна, -1 — без лимита
+
+	// Остаток прошлой аренды, возвращаемый перед новой
+	returnWindow string
+	returned     int64
+}
+
+// leaseGrant is the outcome of a call of the lease script.
+type leaseGrant struct {
+	granted int64
+	count   int64 // последний счётчик аренды или текущий, если ничего не выдано
+	ttl     time.Duration
+	window  string
+}
+
+// LeaseOption configures RedisLeaseCacheAdapter.
+type LeaseOption func(*RedisLeaseCacheAdapter)
+
+// WithLeaseSize sets the number of units leased from Redis at once.
+//
+// Defaults to DefaultLeaseSize. A size of one disables leasing.
+func WithLeaseSize(size int64) LeaseOption {
+	return func(c *RedisLeaseCacheAdapter) {
+		c.leaseSize = max(1, size)
+	}
+}
+
+// NewRedisLeaseCache creates a Redis-backed Cache implementation
+// that leases quota in chunks.
+//
+// The provided client must support script execution (redis.Scripter)
+// and must not be a pipeline. The lease script is preloaded like in
+// NewRedisCache.
+func NewRedisLeaseCache(client redis.Scripter, opts ...LeaseOption) *RedisLeaseCacheAdapter {
+	c := &RedisLeaseCacheAdapter{
+		client:    client,
+		leaseSize: DefaultLeaseSize,
+		now:       time.Now,
+		leases:    make(map[string]*lease),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	preloadScripts(client, leaseScript)
+
+	return c
+}
+
+// LoadScripts loads the lease script into the Redis script cache
+// with SCRIPT LOAD, see RedisCacheAdapter.LoadScripts.
+func (c *RedisLeaseCacheAdapter) LoadScripts(ctx context.Context) error {
+	return loadScripts(ctx, c.client, leaseScript)
+}
+
+// Increment returns the next count of the current lease for the given key,
+// leasing a new chunk from Redis when the lease is used up or expired.
+//
+// The TTL is set on the Redis key when the first lease of a window
+// creates it and is never extended, ensuring fixed-window behavior.
+func (c *RedisLeaseCacheAdapter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, _, err := c.IncrementBy(ctx, key, 1, ttl)
+	return count, err
+}
+
+// IncrementWithTTL behaves like Increment and additionally
+// returns the time left until the window of the lease ends.
+func (c *RedisLeaseCacheAdapter) IncrementWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return c.IncrementBy(ctx, key, 1, ttl)
+}
+
+// IncrementBy behaves like IncrementWithTTL, taking cost units
+// from the lease instead of one.
+//
+// When fewer than cost units are left, a new lease of at least cost
+// units is taken. It extends the current lease if no other instance
+// leased units in between; otherwise the rest of the current lease
+// is discarded.
+func (c *RedisLeaseCacheAdapter) IncrementBy(ctx context.Context, key string, cost int64, ttl time.Duration) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	l := c.getLease(key)
+
+	// Один запрос аренды на ключ: остальные горутины ждут её результата
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := c.now()
+	if expired := !l.live(now); expired || l.left() < cost {
+		size := max(c.leaseSize, cost)
+
+		grant, err := c.lease(ctx, key, leaseRequest{ttl: ttl, size: size, need: size, limit: -1})
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// Новая аренда продолжает текущую, только если между ними никто не арендовал
+		if first := grant.count - grant.granted + 1; expired || grant.window != l.window || first != l.last+1 {
+			l.next = first
+		}
+		l.last = grant.count
+		l.expireAt = now.Add(grant.ttl)
+		l.window = grant.window
+		l.reserved = false
+	}
+
+	count := l.next + cost - 1
+	l.next += cost
+
+	return count, l.expireAt.Sub(now), nil
+}
+
+// Reserve takes counter.Amount() units from the lease of the counter
+// key, leasing more from Redis against counter.Limit when the lease
+// cannot serve the request.
+//
+// Remaining is estimated from the Redis counter as of the last lease
+// and the units left in the lease of this instance.
+func (c *RedisLeaseCacheAdapter) Reserve(ctx context.Context, counter quota.Counter) (quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return quota.Result{}, err
+	}
+
+	need := counter.Amount()
+	limit := max(0, counter.Limit)
+
+	l := c.getLease(counter.Key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := c.now()
+	if !l.live(now) || l.left() < need {
+		req := leaseRequest{ttl: counter.Window, size: c.leaseSize, need: need, limit: limit}
+		if l.live(now) && l.reserved {
+			req.returnWindow, req.returned = l.window, l.left()
+		}
+
+		grant, err := c.lease(ctx, counter.Key, req)
+		if err != nil {
+			// Неизвестно, вернулся ли остаток, поэтому повторно его не возвращаем
+			l.next = l.last + 1
+			return quota.Result{}, err
+		}
+
+		l.next = grant.count - grant.granted + 1
+		l.last = grant.count
+		l.expireAt = now.Add(grant.ttl)
+		l.window = grant.window
+		l.reserved = true
+
+		if grant.granted == 0 {
+			return quota.Result{Allowed: false, RetryAfter: grant.ttl, ResetAfter: grant.ttl}, nil
+		}
+	}
+
+	l.next += need
+
+	return quota.Result{
+		Allowed:    true,
+		Remaining:  max(0, limit-l.last) + l.left(),
+		ResetAfter: l.expireAt.Sub(now),
+	}, nil
+}
+
+// Release gives the units left in the leases taken by Reserve back
+// to Redis, so that other instances can use them before the window
+// ends. Call it when the instance shuts down; the adapter remains
+// usable afterwards.
+func (c *RedisLeaseCacheAdapter) Release(ctx context.Context) error {
+	c.mu.Lock()
+	leases := maps.Clone(c.leases)
+	c.mu.Unlock()
+
+	var errs []error
+	for key, l := range leases {
+		if err := c.release(ctx, key, l); err != nil {
+			errs = append(errs, fmt.Errorf("release %q: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// release gives the units left in the given lease back to Redis.
+func (c *RedisLeaseCacheAdapter) release(ctx context.Context, key string, l *lease) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := c.now()
+	if !l.reserved || !l.live(now) || l.left() <= 0 {
+		return nil
+	}
+
+	_, err := c.lease(ctx, key, leaseRequest{
+		ttl:          l.expireAt.Sub(now),
+		limit:        -1,
+		returnWindow: l.window,
+		returned:     l.left(),
+	})
+
+	// Остаток не возвращаем повторно, даже если ответ не получен
+	l.next = l.last + 1
+
+	return err
+}
+
+// lease runs the lease script for the given key.
+//
+// The key is created with a new random window id, which lets
+// the script refuse units given back from an earlier window.
+func (c *RedisLeaseCacheAdapter) lease(ctx context.Context, key string, req leaseRequest) (leaseGrant, error) {
+	res, err := runScript(
+		ctx,
+		c.client,
+		leaseScript,
+		[]string{key},
+		max(1, req.ttl.Milliseconds()),
+		strconv.FormatUint(rand.Uint64(), 36),
+		req.size,
+		req.need,
+		req.limit,
+		req.returnWindow,
+		req.returned,
+		leaseQuotaShare,
+	).Slice()
+	if err != nil {
+		return leaseGrant{}, err
+	}
+
+	if len(res) != 4 {
+		return leaseGrant{}, fmt.Errorf("unexpected result length %d", len(res))
+	}
+
+	granted, ok1 := res[0].(int64)
+	count, ok2 := res[1].(int64)
+	ttl, ok3 := res[2].(int64)
+	window, ok4 := res[3].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return leaseGrant{}, fmt.Errorf("unexpected result %v", res)
+	}
+
+	return leaseGrant{
+		granted: granted,
+		count:   count,
+		ttl:     time.Duration(ttl) * time.Millisecond,
+		window:  window,
+	}, nil
+}
+
+// getLease returns the local lease of the given key, creating an empty one
+// if needed. Expired leases of other keys are swept at most once per
+// leaseSweepInterval.
+func (c *RedisLeaseCacheAdapter) getLease(key string) *lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) >= leaseSweepInterval {
+		c.sweep(now)
+		c.lastSweep = now
+	}
+
+	l, ok := c.leases[key]
+	if !ok {
+		l = &lease{}
+		c.leases[key] = l
+	}
+
+	return l
+}
+
+// sweep discards the leases whose window has ended,
+// together with their unused units. Must be called with c.mu held.
+func (c *RedisLeaseCacheAdapter) sweep(now time.Time) {
+	for key, l := range c.leases {
+		// Аренду, занятую другим вызовом, пропускаем до следующего прохода
+		if !l.mu.TryLock() {
+			continue
+		}
+
+		if !l.live(now) {
+			delete(c.leases, key)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,117 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cachetest"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+func TestRedisLeaseConformance(t *testing.T) {
+	server, client := newTestRedis(t)
+	fastForward(t, server)
+
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		return NewRedisLeaseCache(client, WithLeaseSize(5))
+	})
+}
+
+// TestReserveSharesLimitBetweenInstances checks that instances leasing
+// the same key admit exactly the limit between them.
+func TestReserveSharesLimitBetweenInstances(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	instances := []*RedisLeaseCacheAdapter{NewRedisLeaseCache(client), NewRedisLeaseCache(client)}
+	counter := quota.Counter{Key: "key", Window: time.Minute, Limit: 10}
+
+	var allowed []int
+	for i := 0; i < 30; i++ {
+		res, err := instances[i%2].Reserve(context.Background(), counter)
+		if err != nil {
+			t.Fatalf("Reserve #%d: %v", i+1, err)
+		}
+		if res.Allowed {
+			allowed = append(allowed, i)
+		}
+	}
+
+	if len(allowed) != 10 {
+		t.Fatalf("allowed %d requests, want 10", len(allowed))
+	}
+	if allowed[1] != 1 {
+		t.Fatalf("first request of the second instance rejected")
+	}
+}
+
+// TestReserveGivesBackUnusedUnits checks that units left in a lease
+// return to Redis when the lease is replaced or released.
+func TestReserveGivesBackUnusedUnits(t *testing.T) {
+	server, client := newTestRedis(t)
+
+	first, second := NewRedisLeaseCache(client), NewRedisLeaseCache(client)
+	counter := quota.Counter{Key: "key", Window: time.Minute, Limit: 100}
+
+	mustReserve(t, first, counter, true)
+	mustLeased(t, server.HGet("key", "n"), "10")
+
+	// Остаток аренды не покрывает запрос и возвращается вместе с новой арендой
+	mustReserve(t, first, quota.Counter{Key: "key", Window: time.Minute, Limit: 100, Cost: 20}, true)
+	mustLeased(t, server.HGet("key", "n"), "21")
+
+	// Аренды уменьшаются по мере приближения к лимиту: 79 свободных единиц дают аренду из 7
+	mustReserve(t, first, counter, true)
+	mustLeased(t, server.HGet("key", "n"), "28")
+
+	if err := first.Release(context.Background()); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	mustLeased(t, server.HGet("key", "n"), "22")
+
+	mustReserve(t, second, quota.Counter{Key: "key", Window: time.Minute, Limit: 100, Cost: 78}, true)
+	mustReserve(t, second, counter, false)
+}
+
+// TestReleaseIgnoresEndedWindow checks that units leased in a window
+// that has ended in Redis are not given back to the next window.
+func TestReleaseIgnoresEndedWindow(t *testing.T) {
+	server, client := newTestRedis(t)
+
+	first, second := NewRedisLeaseCache(client), NewRedisLeaseCache(client)
+	counter := quota.Counter{Key: "key", Window: time.Minute, Limit: 100}
+
+	mustReserve(t, first, counter, true)
+
+	server.FastForward(2 * time.Minute)
+	mustReserve(t, second, counter, true)
+
+	if err := first.Release(context.Background()); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	mustLeased(t, server.HGet("key", "n"), "10")
+}
+
+// mustReserve reserves the counter and fails the test
+// unless the request is allowed as expected.
+func mustReserve(t *testing.T, cache *RedisLeaseCacheAdapter, counter quota.Counter, allowed bool) {
+	t.Helper()
+
+	res, err := cache.Reserve(context.Background(), counter)
+	if err != nil {
+		t.Fatalf("Reserve(%d): %v", counter.Amount(), err)
+	}
+	if res.Allowed != allowed {
+		t.Fatalf("Reserve(%d): allowed = %t, want %t", counter.Amount(), res.Allowed, allowed)
+	}
+}
+
+// mustLeased fails the test unless the Redis counter holds want units.
+func mustLeased(t *testing.T, got, want string) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("leased %s units, want %s", got, want)
+	}
+}
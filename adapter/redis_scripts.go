@@ -0,0 +1,359 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scriptPreloadTimeout bounds the best-effort script preloading
+// done by the Redis adapter constructors.
+const scriptPreloadTimeout = time.Second
+
+// ErrPipelineNotSupported is returned when a Redis adapter is given
+// a redis.Pipeliner: pipelined commands are only executed by Exec,
+// while every cache call needs its reply right away.
+var ErrPipelineNotSupported = fmt.Errorf("redis pipelines are not supported: %w", errors.ErrUnsupported)
+
+// Lua scripts used by RedisCacheAdapter and RedisLeaseCacheAdapter.
+//
+// Scripts are created once at package initialization, so their SHA1
+// digests are computed only once. Script.Run uses EVALSHA and falls
+// back to EVAL when the server replies with NOSCRIPT.
+var (
+	// incrementScript increments a counter by ARGV[2] and sets its TTL
+	// (ARGV[1]) on creation only. Returns {count, pttl}.
+	incrementScript = redis.NewScript(`
+		local cost = tonumber(ARGV[2])
+		local current = redis.call("INCRBY", KEYS[1], cost)
+		if current == cost then
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+		return {current, redis.call("PTTL", KEYS[1])}
+	`)
+
+	// incrementMultiScript increments every key independently.
+	// ARGV holds a {window, limit, cost} triple per key.
+	// Returns a flat {allowed, remaining, retryAfter, resetAfter} list per key.
+	incrementMultiScript = redis.NewScript(`
+		local res = {}
+		for i = 1, #KEYS do
+			local window = tonumber(ARGV[i * 3 - 2])
+			local limit = tonumber(ARGV[i * 3 - 1])
+			local cost = tonumber(ARGV[i * 3])
+
+			local count = redis.call("INCRBY", KEYS[i], cost)
+			if count == cost then
+				redis.call("PEXPIRE", KEYS[i], window)
+			end
+
+			local ttl = redis.call("PTTL", KEYS[i])
+			if ttl < 0 then
+				ttl = window
+			end
+
+			local allowed = 0
+			local retryAfter = ttl
+			if count <= limit then
+				allowed = 1
+				retryAfter = 0
+			end
+
+			table.insert(res, allowed)
+			table.insert(res, math.max(0, limit - count))
+			table.insert(res, retryAfter)
+			table.insert(res, ttl)
+		end
+		return res
+	`)
+
+	// incrementAllScript increments every key only if all of them stay
+	// within their limits. ARGV holds a {window, limit, cost} triple per key.
+	// Returns a flat {allowed, remaining, retryAfter, resetAfter} list per key.
+	incrementAllScript = redis.NewScript(`
+		local counts = {}
+		local allowed = true
+		for i = 1, #KEYS do
+			counts[i] = tonumber(redis.call("GET", KEYS[i])) or 0
+			if counts[i] + tonumber(ARGV[i * 3]) > tonumber(ARGV[i * 3 - 1]) then
+				allowed = false
+			end
+		end
+
+		local res = {}
+		for i = 1, #KEYS do
+			local window = tonumber(ARGV[i * 3 - 2])
+			local limit = tonumber(ARGV[i * 3 - 1])
+			local cost = tonumber(ARGV[i * 3])
+			local count = counts[i]
+			local counterAllowed = 0
+			if count + cost <= limit then
+				counterAllowed = 1
+			end
+
+			if allowed then
+				count = redis.call("INCRBY", KEYS[i], cost)
+				if count == cost then
+					redis.call("PEXPIRE", KEYS[i], window)
+				end
+			end
+
+			local ttl = redis.call("PTTL", KEYS[i])
+			if ttl < 0 then
+				ttl = window
+			end
+
+			local retryAfter = 0
+			if counterAllowed == 0 then
+				retryAfter = ttl
+			end
+
+			table.insert(res, counterAllowed)
+			table.insert(res, math.max(0, limit - count))
+			table.insert(res, retryAfter)
+			table.insert(res, ttl)
+		end
+		return res
+	`)
+
+	// takeTokenScript refills a token bucket and takes ARGV[3] tokens from it.
+	// A request costing more than the capacity is rejected with the time
+	// to refill the whole bucket. Delays are capped at 2^53 microseconds.
+	// Returns {allowed, remaining, retryAfter, resetAfter} in microseconds.
+	takeTokenScript = redis.NewScript(`
+		local maxDelay = 2 ^ 53
+		local capacity = tonumber(ARGV[1])
+		local interval = tonumber(ARGV[2])
+		local cost = tonumber(ARGV[3])
+		local time = redis.call("TIME")
+		local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+		local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+		local tokens = tonumber(state[1])
+		local ts = tonumber(state[2])
+		if tokens == nil or ts == nil then
+			tokens = capacity
+			ts = now
+		end
+
+		if now > ts and interval > 0 then
+			tokens = math.min(capacity, tokens + (now - ts) / interval)
+			ts = now
+		end
+
+		local allowed = 0
+		local retryAfter = 0
+		if cost > capacity then
+			retryAfter = math.min(maxDelay, capacity * interval)
+		elseif tokens >= cost then
+			tokens = tokens - cost
+			allowed = 1
+		else
+			retryAfter = math.min(maxDelay, math.ceil((cost - tokens) * interval))
+		end
+
+		local resetAfter = math.min(maxDelay, math.ceil((capacity - tokens) * interval))
+		redis.call("HSET", KEYS[1], "tokens", tokens, "ts", ts)
+		redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil(resetAfter / 1000)))
+		return {allowed, math.floor(tokens), retryAfter, resetAfter}
+	`)
+
+	// incrementSlidingScript increments the current window of a sliding
+	// window counter by ARGV[2]. Returns {weighted count, window end}
+	// in milliseconds.
+	incrementSlidingScript = redis.NewScript(`
+		local window = tonumber(ARGV[1])
+		local cost = tonumber(ARGV[2])
+		local time = redis.call("TIME")
+		local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+		local index = math.floor(now / window)
+
+		local state = redis.call("HMGET", KEYS[1], "index", "current", "previous")
+		local stored = tonumber(state[1])
+		local current = tonumber(state[2]) or 0
+		local previous = tonumber(state[3]) or 0
+		if stored == index - 1 then
+			previous = current
+			current = 0
+		elseif stored ~= index then
+			previous = 0
+			current = 0
+		end
+		current = current + cost
+
+		redis.call("HSET", KEYS[1], "index", index, "current", current, "previous", previous)
+		redis.call("PEXPIRE", KEYS[1], (index + 2) * window - now)
+
+		local windowEnd = (index + 1) * window - now
+		return {current + math.floor(previous * windowEnd / window), windowEnd}
+	`)
+
+	// gcraScript evaluates a request of ARGV[3] cells against a stored TAT.
+	// A request costing more than the burst is rejected with the time
+	// to regain the whole burst. Delays are capped at 2^53 microseconds.
+	// Returns {allowed, remaining, retryAfter, resetAfter} in microseconds.
+	gcraScript = redis.NewScript(`
+		local maxDelay = 2 ^ 53
+		local interval = tonumber(ARGV[1])
+		local burst = tonumber(ARGV[2])
+		local cost = tonumber(ARGV[3])
+		local time = redis.call("TIME")
+		local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+		local tat = tonumber(redis.call("GET", KEYS[1]))
+		if tat == nil or tat < now then
+			tat = now
+		end
+
+		if cost > burst then
+			return {0, 0, math.min(maxDelay, interval * burst), math.min(maxDelay, tat - now)}
+		end
+
+		local newTat = tat + interval * cost
+		local allowAt = newTat - interval * burst
+		if now < allowAt then
+			return {0, 0, math.min(maxDelay, allowAt - now), math.min(maxDelay, tat - now)}
+		end
+
+		redis.call("SET", KEYS[1], newTat, "PX", math.max(1, math.ceil((newTat - now) / 1000)))
+		return {1, math.floor((interval * burst - (newTat - now)) / interval), 0, math.min(maxDelay, newTat - now)}
+	`)
+
+	// appendLogScript records a request of ARGV[4] entries in a sorted-set
+	// log, naming the entries after the ARGV[3] prefix.
+	// Returns {allowed, remaining, retryAfter, resetAfter} in microseconds.
+	appendLogScript = redis.NewScript(`
+		local window = tonumber(ARGV[1])
+		local limit = tonumber(ARGV[2])
+		local cost = tonumber(ARGV[4])
+		local time = redis.call("TIME")
+		local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+		redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+
+		local count = redis.call("ZCARD", KEYS[1])
+		if count + cost > limit then
+			local retryAfter = window
+			local resetAfter = window
+			if count > 0 then
+				local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+				resetAfter = tonumber(newest[2]) + window - now
+			end
+			-- Запрос дороже всего лога не пройдёт никогда — ждём полное окно
+			if cost <= limit then
+				local index = count + cost - limit - 1
+				local oldest = redis.call("ZRANGE", KEYS[1], index, index, "WITHSCORES")
+				retryAfter = tonumber(oldest[2]) + window - now
+			end
+			return {0, 0, retryAfter, resetAfter}
+		end
+
+		for i = 1, cost do
+			redis.call("ZADD", KEYS[1], now, ARGV[3] .. ":" .. i)
+		end
+		redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil(window / 1000)))
+		return {1, limit - count - cost, 0, window}
+	`)
+
+	// leaseScript leases units of a counter stored as a hash with the
+	// count (n) and the id of its window (w). KEYS[1] is created with
+	// the window id ARGV[2] and TTL ARGV[1], which is never extended.
+	//
+	// ARGV[7] units left from a lease of window ARGV[6] are first given
+	// back, unless that window has ended. Then a lease of ARGV[3] units
+	// is taken. With a non-negative limit ARGV[5] the lease is clipped to
+	// 1/ARGV[8] of the units left, but never below the ARGV[4] units
+	// needed; if fewer are left, nothing is taken.
+	// Returns {granted, count, pttl, window}, count being the last unit
+	// of the lease, or the current count when nothing is granted.
+	leaseScript = redis.NewScript(`
+		if redis.call("EXISTS", KEYS[1]) == 0 then
+			redis.call("HSET", KEYS[1], "n", 0, "w", ARGV[2])
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+
+		local window = redis.call("HGET", KEYS[1], "w")
+		local count = tonumber(redis.call("HGET", KEYS[1], "n"))
+
+		local returned = tonumber(ARGV[7])
+		if returned > 0 and ARGV[6] == window then
+			count = redis.call("HINCRBY", KEYS[1], "n", -math.min(returned, count))
+		end
+
+		local size = tonumber(ARGV[3])
+		local need = tonumber(ARGV[4])
+		local limit = tonumber(ARGV[5])
+		local granted = size
+		if limit >= 0 then
+			local available = limit - count
+			if available < need then
+				granted = 0
+			else
+				granted = math.max(need, math.min(size, math.floor(available / tonumber(ARGV[8]))))
+			end
+		end
+		if granted > 0 then
+			count = redis.call("HINCRBY", KEYS[1], "n", granted)
+		end
+
+		local ttl = redis.call("PTTL", KEYS[1])
+		if ttl < 0 then
+			ttl = tonumber(ARGV[1])
+		end
+		return {granted, count, ttl, window}
+	`)
+)
+
+// runScript runs the script with EVALSHA, falling back to EVAL
+// on NOSCRIPT. Pipelined clients get ErrPipelineNotSupported.
+func runScript(ctx context.Context, client redis.Scripter, script *redis.Script, keys []string, args ...any) *redis.Cmd {
+	if _, ok := client.(redis.Pipeliner); ok {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(ErrPipelineNotSupported)
+
+		return cmd
+	}
+
+	return script.Run(ctx, client, keys, args...)
+}
+
+// loadScripts loads the scripts into the Redis script cache with SCRIPT LOAD.
+// On Redis Cluster the scripts are loaded on every master.
+func loadScripts(ctx context.Context, client redis.Scripter, scripts ...*redis.Script) error {
+	if _, ok := client.(redis.Pipeliner); ok {
+		return ErrPipelineNotSupported
+	}
+
+	for _, script := range scripts {
+		if err := script.Load(ctx, client).Err(); err != nil {
+			return fmt.Errorf("load script: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// preloadScripts loads the scripts within scriptPreloadTimeout,
+// ignoring failures: scripts missing on the server are sent
+// with EVAL on first use.
+func preloadScripts(client redis.Scripter, scripts ...*redis.Script) {
+	ctx, cancel := context.WithTimeout(context.Background(), scriptPreloadTimeout)
+	defer cancel()
+
+	_ = loadScripts(ctx, client, scripts...)
+}
+
+// redisScripts lists all scripts for preloading with SCRIPT LOAD.
+var redisScripts = []*redis.Script{
+	incrementScript,
+	incrementMultiScript,
+	incrementAllScript,
+	takeTokenScript,
+	incrementSlidingScript,
+	gcraScript,
+	appendLogScript,
+	leaseScript,
+}
@@ -0,0 +1,156 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultSQLTable is the default name of the counters table.
+const DefaultSQLTable = "rate_limiter_counters"
+
+// SQLCacheAdapter implements the Cache interface over database/sql.
+//
+// Every increment is a single atomic upsert (INSERT ... ON CONFLICT DO UPDATE
+// ... RETURNING) that restarts the counter when the stored window has expired
+// and otherwise increments it without touching its expiry, ensuring
+// fixed-window behavior. Queries use $N placeholders and work with
+// PostgreSQL and SQLite 3.35+.
+//
+// Expiry timestamps are stored as Unix milliseconds taken from the
+// application clock, so instances sharing a table should keep their
+// clocks in sync. Expired rows are restarted in place on access;
+// rows of keys that are never accessed again are removed by DeleteExpired
+// or RunCleanup.
+type SQLCacheAdapter struct {
+	db    *sql.DB
+	table string
+	now   func() time.Time
+
+	createTableQuery string
+	createIndexQuery string
+	incrementQuery   string
+	deleteQuery      string
+}
+
+// SQLOption configures SQLCacheAdapter.
+type SQLOption func(*SQLCacheAdapter)
+
+// WithSQLTable sets the name of the counters table.
+//
+// Defaults to DefaultSQLTable. The name is inserted into queries as is
+// and must be a valid, trusted SQL identifier.
+func WithSQLTable(table string) SQLOption {
+	return func(c *SQLCacheAdapter) {
+		c.table = table
+	}
+}
+
+// NewSQLCache creates a database/sql-backed Cache implementation.
+//
+// The counters table must exist, see CreateTable.
+func NewSQLCache(db *sql.DB, opts ...SQLOption) *SQLCacheAdapter {
+	c := &SQLCacheAdapter{
+		db:    db,
+		table: DefaultSQLTable,
+		now:   time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Запросы строятся один раз, после применения опций
+	c.createTableQuery = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			rate_key   TEXT PRIMARY KEY,
+			counter    BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`, c.table)
+	c.createIndexQuery = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_expires_at_idx ON %[1]s (expires_at)`, c.table)
+	// $1 — ключ, $2 — конец нового окна, $3 — текущее время (Unix ms), $4 — стоимость
+	c.incrementQuery = fmt.Sprintf(`INSERT INTO %[1]s AS c (rate_key, counter, expires_at)
+			VALUES ($1, $4, $2)
+			ON CONFLICT (rate_key) DO UPDATE SET
+				counter    = CASE WHEN c.expires_at <= $3 THEN excluded.counter ELSE c.counter + excluded.counter END,
+				expires_at = CASE WHEN c.expires_at <= $3 THEN excluded.expires_at ELSE c.expires_at END
+			RETURNING counter, expires_at`, c.table)
+	c.deleteQuery = fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= $1`, c.table)
+
+	return c
+}
+
+// CreateTable creates the counters table and its expiry index
+// if they do not exist yet.
+func (c *SQLCacheAdapter) CreateTable(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, c.createTableQuery); err != nil {
+		return fmt.Errorf("create table: %w", err)
+	}
+
+	if _, err := c.db.ExecContext(ctx, c.createIndexQuery); err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+
+	return nil
+}
+
+// Increment atomically increments the counter for the given key.
+//
+// The expiry is set only when the row is created or its window
+// has expired, and is not extended on subsequent calls.
+func (c *SQLCacheAdapter) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, _, err := c.IncrementBy(ctx, key, 1, ttl)
+	return count, err
+}
+
+// IncrementWithTTL behaves like Increment and additionally
+// returns the time left until the window of the key expires.
+func (c *SQLCacheAdapter) IncrementWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return c.IncrementBy(ctx, key, 1, ttl)
+}
+
+// IncrementBy behaves like IncrementWithTTL,
+// incrementing the counter by cost instead of one.
+func (c *SQLCacheAdapter) IncrementBy(ctx context.Context, key string, cost int64, ttl time.Duration) (int64, time.Duration, error) {
+	now := c.now().UnixMilli()
+
+	var count, expiresAt int64
+	if err := c.db.QueryRowContext(ctx, c.incrementQuery, key, now+ttl.Milliseconds(), now, cost).Scan(&count, &expiresAt); err != nil {
+		return 0, 0, fmt.Errorf("upsert counter: %w", err)
+	}
+
+	return count, time.Duration(expiresAt-now) * time.Millisecond, nil
+}
+
+// DeleteExpired deletes the rows whose window has expired
+// and returns the number of deleted rows.
+func (c *SQLCacheAdapter) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := c.db.ExecContext(ctx, c.deleteQuery, c.now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// RunCleanup calls DeleteExpired every interval until ctx is done.
+//
+// Errors are passed to onError, if not nil, and do not stop the cleanup.
+// It is intended to run in its own goroutine:
+//
+//	go sqlCache.RunCleanup(ctx, time.Minute, func(err error) { ... })
+func (c *SQLCacheAdapter) RunCleanup(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.DeleteExpired(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
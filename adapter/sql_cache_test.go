@@ -0,0 +1,70 @@
+package adapter
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cachetest"
+)
+
+// newTestSQLCache creates a cache over a fresh SQLite database
+// with the counters table created.
+func newTestSQLCache(t *testing.T) *SQLCacheAdapter {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+t.TempDir()+"/counters.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	c := NewSQLCache(db)
+	if err := c.CreateTable(context.Background()); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	return c
+}
+
+func TestSQLConformance(t *testing.T) {
+	c := newTestSQLCache(t)
+
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		return c
+	})
+}
+
+func TestSQLDeleteExpired(t *testing.T) {
+	c := newTestSQLCache(t)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, err := c.Increment(ctx, "short", time.Second); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if _, err := c.Increment(ctx, "long", time.Hour); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	deleted, err := c.DeleteExpired(ctx)
+	if err != nil {
+		t.Fatalf("DeleteExpired: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted %d rows, want 1", deleted)
+	}
+
+	// Счётчик действующего окна не должен был пострадать
+	if count, err := c.Increment(ctx, "long", time.Hour); err != nil || count != 2 {
+		t.Fatalf("Increment(long) = %d, %v, want 2", count, err)
+	}
+}
@@ -0,0 +1,224 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// checkRule evaluates the given rule with its configured algorithm
+// against the given cache and returns whether the request, counted
+// as cost units, is allowed within the configured limit.
+func (rl *RateLimiter) checkRule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	switch rule.Algorithm {
+	case AlgorithmTokenBucket:
+		return rl.checkTokenBucketRule(ctx, cache, fullRateKey, rule, cost)
+	case AlgorithmSlidingWindow:
+		return rl.checkSlidingWindowRule(ctx, cache, fullRateKey, rule, cost)
+	case AlgorithmGCRA:
+		return rl.checkGCRARule(ctx, cache, fullRateKey, rule, cost)
+	case AlgorithmSlidingLog:
+		return rl.checkSlidingLogRule(ctx, cache, fullRateKey, rule, cost)
+	default:
+		return rl.checkFixedWindowRule(ctx, cache, fullRateKey, rule, cost)
+	}
+}
+
+// checkFixedWindowRule increments the counter for the given rule and returns
+// whether the request is allowed within the configured limit.
+//
+// It relies on the cache to provide atomic fixed-window semantics.
+// If the cache implements QuotaCache, the quota is reserved against
+// the rule limit instead. If the cache implements TTLCache,
+// the remaining window TTL is used as the retry delay; otherwise
+// the full window is assumed. Requests costing more than one unit
+// require CostCache.
+func (rl *RateLimiter) checkFixedWindowRule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	if quotaCache, ok := cache.(QuotaCache); ok {
+		res, err := quotaCache.Reserve(ctx, quota.Counter{Key: fullRateKey, Window: rule.Window, Limit: int64(rule.Limit), Cost: cost})
+		if err != nil {
+			rl.logger.Errorf("reserve failed for key %q: %v", fullRateKey, err)
+			return quota.Result{}, fmt.Errorf("reserve: %w", err)
+		}
+
+		return res, nil
+	}
+
+	var (
+		count int64
+		ttl   = rule.Window
+		err   error
+	)
+
+	costCache, costOK := cache.(CostCache)
+	ttlCache, ttlOK := cache.(TTLCache)
+
+	switch {
+	case costOK:
+		count, ttl, err = costCache.IncrementBy(ctx, fullRateKey, cost, rule.Window)
+	case cost != 1:
+		return quota.Result{}, fmt.Errorf("fixed window: %w", ErrCostNotSupported)
+	case ttlOK:
+		count, ttl, err = ttlCache.IncrementWithTTL(ctx, fullRateKey, rule.Window)
+	default:
+		count, err = cache.Increment(ctx, fullRateKey, rule.Window)
+	}
+	if err != nil {
+		rl.logger.Errorf("increment failed for key %q: %v", fullRateKey, err)
+		return quota.Result{}, fmt.Errorf("increment: %w", err)
+	}
+
+	return countResult(count, rule.Limit, ttl), nil
+}
+
+// checkTokenBucketRule takes cost tokens from the bucket of the given rule
+// and returns whether the request is allowed.
+//
+// The bucket holds up to Burst tokens (Limit when Burst is zero)
+// and is refilled with Limit tokens per Window.
+func (rl *RateLimiter) checkTokenBucketRule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	tokenBucketCache, ok := cache.(TokenBucketCache)
+	if !ok {
+		return quota.Result{}, fmt.Errorf("token bucket: %w", ErrAlgorithmNotSupported)
+	}
+
+	if rule.Limit <= 0 {
+		return quota.Result{Allowed: false, RetryAfter: rule.Window, ResetAfter: rule.Window}, nil
+	}
+
+	// Без интервала пополнения бакет никогда не наполнится
+	if err := checkWindow(rule); err != nil {
+		return quota.Result{}, err
+	}
+	refillInterval := rule.Window / time.Duration(rule.Limit)
+
+	capacity := rule.Burst
+	if capacity <= 0 {
+		capacity = rule.Limit
+	}
+
+	res, err := tokenBucketCache.TakeToken(ctx, fullRateKey, cost, int64(capacity), refillInterval)
+	if err != nil {
+		rl.logger.Errorf("take token failed for key %q: %v", fullRateKey, err)
+		return quota.Result{}, fmt.Errorf("take token: %w", err)
+	}
+
+	return res, nil
+}
+
+// checkSlidingWindowRule increments the sliding window counter
+// of the given rule by cost and returns whether the request is allowed.
+//
+// The weighted count of the current and previous windows is compared
+// against the rule limit.
+func (rl *RateLimiter) checkSlidingWindowRule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	slidingWindowCache, ok := cache.(SlidingWindowCache)
+	if !ok {
+		return quota.Result{}, fmt.Errorf("sliding window: %w", ErrAlgorithmNotSupported)
+	}
+
+	if err := checkWindow(rule); err != nil {
+		return quota.Result{}, err
+	}
+
+	count, windowEnd, err := slidingWindowCache.IncrementSliding(ctx, fullRateKey, cost, rule.Window)
+	if err != nil {
+		rl.logger.Errorf("sliding increment failed for key %q: %v", fullRateKey, err)
+		return quota.Result{}, fmt.Errorf("sliding increment: %w", err)
+	}
+
+	return countResult(count, rule.Limit, windowEnd), nil
+}
+
+// checkGCRARule evaluates the given rule with the generic cell rate
+// algorithm and returns whether the request is allowed.
+//
+// Requests are spaced by Window/Limit with bursts of up to Burst
+// requests (Limit when Burst is zero).
+func (rl *RateLimiter) checkGCRARule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	gcraCache, ok := cache.(GCRACache)
+	if !ok {
+		return quota.Result{}, fmt.Errorf("gcra: %w", ErrAlgorithmNotSupported)
+	}
+
+	if rule.Limit <= 0 {
+		return quota.Result{Allowed: false, RetryAfter: rule.Window, ResetAfter: rule.Window}, nil
+	}
+
+	// Нулевой интервал между запросами не задаёт никакого темпа
+	if err := checkWindow(rule); err != nil {
+		return quota.Result{}, err
+	}
+	emissionInterval := rule.Window / time.Duration(rule.Limit)
+
+	burst := rule.Burst
+	if burst <= 0 {
+		burst = rule.Limit
+	}
+
+	res, err := gcraCache.AllowGCRA(ctx, fullRateKey, cost, emissionInterval, int64(burst))
+	if err != nil {
+		rl.logger.Errorf("gcra failed for key %q: %v", fullRateKey, err)
+		return quota.Result{}, fmt.Errorf("gcra: %w", err)
+	}
+
+	return res, nil
+}
+
+// checkSlidingLogRule records the request as cost entries in the sliding
+// log of the given rule and returns whether the request is allowed.
+func (rl *RateLimiter) checkSlidingLogRule(ctx context.Context, cache Cache, fullRateKey string, rule Rule, cost int64) (quota.Result, error) {
+	slidingLogCache, ok := cache.(SlidingLogCache)
+	if !ok {
+		return quota.Result{}, fmt.Errorf("sliding log: %w", ErrAlgorithmNotSupported)
+	}
+
+	if rule.Limit <= 0 {
+		return quota.Result{Allowed: false, RetryAfter: rule.Window, ResetAfter: rule.Window}, nil
+	}
+
+	if err := checkWindow(rule); err != nil {
+		return quota.Result{}, err
+	}
+
+	res, err := slidingLogCache.AppendLog(ctx, fullRateKey, cost, int64(rule.Limit), rule.Window)
+	if err != nil {
+		rl.logger.Errorf("append log failed for key %q: %v", fullRateKey, err)
+		return quota.Result{}, fmt.Errorf("append log: %w", err)
+	}
+
+	return res, nil
+}
+
+// checkWindow returns an error wrapping ErrInvalidWindow if the window
+// of the rule is not positive or, for the token bucket and GCRA, too short
+// to spread its limit over. Fixed-window rules accept any window.
+func checkWindow(rule Rule) error {
+	valid := true
+	switch rule.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmGCRA:
+		valid = rule.Limit <= 0 || rule.Window/time.Duration(rule.Limit) > 0
+	case AlgorithmSlidingWindow, AlgorithmSlidingLog:
+		valid = rule.Window > 0
+	default:
+	}
+
+	if !valid {
+		return fmt.Errorf("rule %q: window %s for limit %d: %w", rule.Name, rule.Window, rule.Limit, ErrInvalidWindow)
+	}
+
+	return nil
+}
+
+// countResult builds the result of a counter-based rule from the
+// request count observed in the current window and the time until
+// the window resets.
+func countResult(count int64, limit int, resetAfter time.Duration) quota.Result {
+	if count > int64(limit) {
+		return quota.Result{Allowed: false, RetryAfter: resetAfter, ResetAfter: resetAfter}
+	}
+
+	return quota.Result{Allowed: true, Remaining: int64(limit) - count, ResetAfter: resetAfter}
+}
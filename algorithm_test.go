@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestInvalidWindowIsConfigError checks that rules whose window cannot
+// hold their limit fail with ErrInvalidWindow instead of reaching
+// the cache, regardless of the failure policy.
+func TestInvalidWindowIsConfigError(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"sliding window without window", Rule{Name: "r", Limit: 5, Algorithm: AlgorithmSlidingWindow}},
+		{"sliding window with negative window", Rule{Name: "r", Limit: 5, Window: -time.Second, Algorithm: AlgorithmSlidingWindow}},
+		{"token bucket without window", Rule{Name: "r", Limit: 5, Algorithm: AlgorithmTokenBucket}},
+		{"token bucket with window shorter than limit", Rule{Name: "r", Limit: 5, Window: 3 * time.Nanosecond, Algorithm: AlgorithmTokenBucket}},
+		{"sliding log without window", Rule{Name: "r", Limit: 5, Algorithm: AlgorithmSlidingLog}},
+		{"gcra without window", Rule{Name: "r", Limit: 5, Algorithm: AlgorithmGCRA}},
+		{"gcra with window shorter than limit", Rule{Name: "r", Limit: 5, Window: 3 * time.Nanosecond, Algorithm: AlgorithmGCRA}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := New(
+				WithFailurePolicy(FailurePolicyFailOpen),
+				WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1}),
+				WithGlobalLimitRules([]Rule{tt.rule}),
+			)
+			t.Cleanup(func() { _ = rl.Close() })
+
+			if _, err := rl.checkRule(context.Background(), rl.cache, "key", tt.rule, 1); !errors.Is(err, ErrInvalidWindow) {
+				t.Fatalf("checkRule() error = %v, want ErrInvalidWindow", err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := callUnary(rl, "/test.Service/Method"); status.Code(err) != codes.Internal {
+					t.Fatalf("call #%d: got %v, want Internal", i+1, err)
+				}
+			}
+			if state := rl.circuitBreaker.state; state != circuitClosed {
+				t.Fatalf("circuit is %s, want %s", state, circuitClosed)
+			}
+		})
+	}
+}
+
+// callUnary passes a request through the unary interceptor of rl
+// and returns the resulting error.
+func callUnary(rl *RateLimiter, fullMethod string) error {
+	return callUnaryContext(context.Background(), rl, fullMethod)
+}
+
+// callUnaryContext is callUnary with the given request context.
+func callUnaryContext(ctx context.Context, rl *RateLimiter, fullMethod string) error {
+	_, err := rl.UnaryServerInterceptor()(
+		ctx,
+		nil,
+		&grpc.UnaryServerInfo{FullMethod: fullMethod},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+	)
+
+	return err
+}
@@ -0,0 +1,295 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// tokenBucket holds the state of a single token bucket.
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// slidingWindow holds the counts of the current and previous windows.
+type slidingWindow struct {
+	index    int64
+	current  int64
+	previous int64
+}
+
+// gcraState holds the theoretical arrival time of the next request.
+type gcraState struct {
+	tat time.Time
+}
+
+// slidingLog is a ring buffer of the timestamps of allowed requests.
+//
+// The buffer grows on demand up to the rule limit, so a key never
+// holds more than limit entries and keys with few requests stay small.
+type slidingLog struct {
+	entries []time.Time
+	head    int
+	size    int
+	limit   int
+}
+
+// at returns the i-th oldest entry of the log.
+func (l *slidingLog) at(i int) time.Time {
+	return l.entries[(l.head+i)%len(l.entries)]
+}
+
+// reserve grows the buffer to fit n more entries,
+// doubling it but never beyond the limit.
+func (l *slidingLog) reserve(n int) {
+	need := l.size + n
+	if need <= len(l.entries) {
+		return
+	}
+
+	entries := make([]time.Time, min(max(need, 2*len(l.entries)), l.limit))
+	for i := range l.size {
+		entries[i] = l.at(i)
+	}
+	l.entries, l.head = entries, 0
+}
+
+// TakeToken atomically refills the bucket for the given key
+// and takes cost tokens from it if that many are available.
+//
+// A missing bucket starts full. The bucket is refilled by one token
+// per refillInterval and never holds more than capacity tokens.
+// The entry expires once the bucket would be full again.
+// A request costing more than capacity is never allowed: it is rejected
+// with the time to refill the whole bucket as the retry delay.
+func (c *Cache) TakeToken(ctx context.Context, key string, cost, capacity int64, refillInterval time.Duration) (quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return quota.Result{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	e := c.lookup(key, now)
+	bucket, ok := valueOf[*tokenBucket](e)
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(capacity), updatedAt: now}
+		e = c.store(key, bucket)
+	}
+
+	// Пополняем бакет пропорционально прошедшему времени
+	if elapsed := now.Sub(bucket.updatedAt); elapsed > 0 && refillInterval > 0 {
+		bucket.tokens = min(float64(capacity), bucket.tokens+float64(elapsed)/float64(refillInterval))
+		bucket.updatedAt = now
+	}
+
+	allowed := cost <= capacity && bucket.tokens >= float64(cost)
+	if allowed {
+		bucket.tokens -= float64(cost)
+	}
+
+	resetAfter := floatDuration((float64(capacity) - bucket.tokens) * float64(refillInterval))
+	e.expireAt = now.Add(resetAfter)
+
+	res := quota.Result{
+		Allowed:    allowed,
+		Remaining:  int64(bucket.tokens),
+		ResetAfter: resetAfter,
+	}
+	switch {
+	case allowed:
+	case cost > capacity:
+		// Бакет никогда не вместит столько токенов
+		res.RetryAfter = mulDuration(refillInterval, capacity)
+	default:
+		res.RetryAfter = floatDuration((float64(cost) - bucket.tokens) * float64(refillInterval))
+	}
+
+	return res, nil
+}
+
+// IncrementSliding atomically increments the current window counter
+// for the given key by cost and returns the weighted count of the current
+// and previous windows, along with the time until the current window ends.
+//
+// Windows are aligned to multiples of window since the Unix epoch,
+// so window must be positive.
+// The entry expires once the current window is no longer the previous one.
+func (c *Cache) IncrementSliding(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	if window <= 0 {
+		return 0, 0, fmt.Errorf("sliding window must be positive, got %s", window)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	nowNano := now.UnixNano()
+	index := nowNano / int64(window)
+
+	e := c.lookup(key, now)
+	sw, ok := valueOf[*slidingWindow](e)
+	if !ok {
+		sw = &slidingWindow{index: index}
+		e = c.store(key, sw)
+	}
+
+	// Сдвигаем окна, если текущее окно устарело
+	switch sw.index {
+	case index:
+	case index - 1:
+		sw.previous, sw.current = sw.current, 0
+	default:
+		sw.previous, sw.current = 0, 0
+	}
+	sw.index = index
+	sw.current += cost
+
+	windowEnd := (index+1)*int64(window) - nowNano
+	weight := float64(windowEnd) / float64(window)
+	e.expireAt = now.Add(time.Duration(windowEnd) + window)
+
+	return sw.current + int64(float64(sw.previous)*weight), time.Duration(windowEnd), nil
+}
+
+// AllowGCRA atomically evaluates a request against the theoretical
+// arrival time stored for the given key.
+//
+// The TAT is advanced by cost*emissionInterval only for allowed requests.
+// For rejected requests the exact time until the next allowed request
+// is returned. A request costing more than burst is never allowed:
+// it is rejected with the time to regain the whole burst as the retry
+// delay. The entry expires once the TAT is in the past.
+// The emission interval must be positive.
+func (c *Cache) AllowGCRA(ctx context.Context, key string, cost int64, emissionInterval time.Duration, burst int64) (quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return quota.Result{}, err
+	}
+	if emissionInterval <= 0 {
+		return quota.Result{}, fmt.Errorf("emission interval must be positive, got %s", emissionInterval)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	tat := now
+	state, ok := valueOf[*gcraState](c.lookup(key, now))
+	if ok && state.tat.After(now) {
+		tat = state.tat
+	}
+
+	period := mulDuration(emissionInterval, burst)
+
+	// Проверяем до умножения на стоимость: огромная стоимость переполнила бы TAT
+	if cost > burst {
+		return quota.Result{Allowed: false, RetryAfter: period, ResetAfter: tat.Sub(now)}, nil
+	}
+
+	newTat := tat.Add(mulDuration(emissionInterval, cost))
+	allowAt := newTat.Add(-period)
+
+	if now.Before(allowAt) {
+		return quota.Result{
+			Allowed:    false,
+			RetryAfter: allowAt.Sub(now),
+			ResetAfter: tat.Sub(now),
+		}, nil
+	}
+
+	e := c.store(key, &gcraState{tat: newTat})
+	e.expireAt = newTat
+
+	return quota.Result{
+		Allowed:    true,
+		Remaining:  int64((period - newTat.Sub(now)) / emissionInterval),
+		ResetAfter: newTat.Sub(now),
+	}, nil
+}
+
+// AppendLog atomically evicts entries older than window from the log
+// of the given key and records the current time cost times if that
+// many free slots remain below limit.
+//
+// For rejected requests the time until enough entries
+// leave the window is returned. The key expires once
+// its newest entry leaves the window.
+func (c *Cache) AppendLog(ctx context.Context, key string, cost, limit int64, window time.Duration) (quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return quota.Result{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	e := c.lookup(key, now)
+	log, ok := valueOf[*slidingLog](e)
+	if !ok || log.limit != int(limit) {
+		log = &slidingLog{limit: int(limit)}
+		e = c.store(key, log)
+	}
+
+	// Удаляем записи, вышедшие за пределы окна
+	for log.size > 0 && !log.at(0).Add(window).After(now) {
+		log.head = (log.head + 1) % len(log.entries)
+		log.size--
+	}
+
+	if free := limit - int64(log.size); free < cost {
+		res := quota.Result{Allowed: false, RetryAfter: window, ResetAfter: window}
+		if log.size > 0 {
+			res.ResetAfter = log.at(log.size - 1).Add(window).Sub(now)
+		}
+		// Запрос дороже всего лога не пройдёт никогда — ждём полное окно
+		if cost <= limit {
+			res.RetryAfter = log.at(int(cost-free) - 1).Add(window).Sub(now)
+		}
+
+		return res, nil
+	}
+
+	log.reserve(int(cost))
+	for i := int64(0); i < cost; i++ {
+		log.entries[(log.head+log.size)%len(log.entries)] = now
+		log.size++
+	}
+	e.expireAt = now.Add(window)
+
+	return quota.Result{
+		Allowed:    true,
+		Remaining:  limit - int64(log.size),
+		ResetAfter: window,
+	}, nil
+}
+
+// mulDuration returns d*n for non-negative d and n,
+// saturating at the longest representable duration.
+func mulDuration(d time.Duration, n int64) time.Duration {
+	if d != 0 && n > math.MaxInt64/int64(d) {
+		return math.MaxInt64
+	}
+
+	return d * time.Duration(n)
+}
+
+// floatDuration converts a number of nanoseconds into a duration,
+// clamping it to the representable non-negative range.
+func floatDuration(ns float64) time.Duration {
+	if ns >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return time.Duration(max(0, ns))
+}
@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+func TestIncrementSlidingRejectsInvalidWindow(t *testing.T) {
+	c := New(WithSweepInterval(0))
+
+	if _, _, err := c.IncrementSliding(context.Background(), "key", 1, 0); err == nil {
+		t.Fatal("IncrementSliding with zero window: want error")
+	}
+}
+
+func TestAllowGCRARejectsInvalidInterval(t *testing.T) {
+	c := New(WithSweepInterval(0))
+
+	if _, err := c.AllowGCRA(context.Background(), "key", 1, 0, 5); err == nil {
+		t.Fatal("AllowGCRA with zero emission interval: want error")
+	}
+}
+
+// TestOversizedCostRejected checks that requests costing more than
+// the bucket or burst are rejected with a positive retry delay
+// instead of overflowing the delay arithmetic.
+func TestOversizedCostRejected(t *testing.T) {
+	const hugeCost = math.MaxInt32
+
+	c := New(WithSweepInterval(0))
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		res, err := c.AllowGCRA(ctx, "gcra", 200000, 24*time.Hour, 1)
+		if err != nil {
+			t.Fatalf("AllowGCRA: %v", err)
+		}
+		if res.Allowed || res.RetryAfter != 24*time.Hour {
+			t.Fatalf("AllowGCRA #%d = %+v, want rejected with retry after 24h", i+1, res)
+		}
+	}
+
+	res, err := c.AllowGCRA(ctx, "gcra-saturated", hugeCost, time.Duration(math.MaxInt64/2), 3)
+	if err != nil {
+		t.Fatalf("AllowGCRA: %v", err)
+	}
+	if res.Allowed || res.RetryAfter != math.MaxInt64 {
+		t.Fatalf("AllowGCRA with saturated period = %+v, want rejected with the longest retry delay", res)
+	}
+
+	res, err = c.TakeToken(ctx, "bucket", hugeCost, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("TakeToken: %v", err)
+	}
+	if res.Allowed || res.RetryAfter != 10*time.Hour || res.ResetAfter < 0 {
+		t.Fatalf("TakeToken = %+v, want rejected with retry after 10h", res)
+	}
+
+	// Отклонённый запрос не должен был израсходовать токены
+	if res, _ := c.TakeToken(ctx, "bucket", 10, 10, time.Hour); !res.Allowed {
+		t.Fatalf("TakeToken of the whole bucket = %+v, want allowed", res)
+	}
+}
+
+// fakeClock is a manually advanced time source for WithClock.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Unix(1700000000, 0)}
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// algorithmStep is one request of a deterministic algorithm test:
+// the clock is advanced, the request is made and its result is checked.
+type algorithmStep struct {
+	advance    time.Duration
+	cost       int64
+	allowed    bool
+	remaining  int64
+	retryAfter time.Duration
+}
+
+// runSteps makes the requests of steps with call, advancing the clock
+// before each of them, and checks Allowed, Remaining and RetryAfter.
+func runSteps(t *testing.T, clock *fakeClock, steps []algorithmStep, call func(cost int64) (quota.Result, error)) {
+	t.Helper()
+
+	for i, step := range steps {
+		clock.advance(step.advance)
+
+		res, err := call(step.cost)
+		if err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+		if res.Allowed != step.allowed || res.Remaining != step.remaining || res.RetryAfter != step.retryAfter {
+			t.Fatalf("step %d: got allowed=%t remaining=%d retry=%s, want allowed=%t remaining=%d retry=%s",
+				i+1, res.Allowed, res.Remaining, res.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+		}
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	const (
+		limit  = 3
+		window = 10 * time.Second
+	)
+
+	clock := newFakeClock()
+	c := New(WithSweepInterval(0), WithClock(clock.now))
+
+	runSteps(t, clock, []algorithmStep{
+		{cost: 1, allowed: true, remaining: 2},
+		{advance: 2 * time.Second, cost: 2, allowed: true, remaining: 0},
+		// Лог заполнен: ждём выхода самой старой записи
+		{advance: time.Second, cost: 1, allowed: false, retryAfter: 7 * time.Second},
+		// Двум запросам нужно дождаться выхода второй записи
+		{cost: 2, allowed: false, retryAfter: 9 * time.Second},
+		// Запрос дороже лимита не пройдёт никогда
+		{cost: limit + 1, allowed: false, retryAfter: window},
+		// Первая запись вышла за пределы окна
+		{advance: 7 * time.Second, cost: 1, allowed: true, remaining: 0},
+		{advance: 2 * time.Second, cost: 2, allowed: true, remaining: 0},
+	}, func(cost int64) (quota.Result, error) {
+		return c.AppendLog(context.Background(), "key", cost, limit, window)
+	})
+}
+
+// TestAppendLogGrowsLazily checks that the log buffer grows with
+// the number of entries rather than the limit and keeps entries
+// in order when it grows after wrapping around.
+func TestAppendLogGrowsLazily(t *testing.T) {
+	const (
+		limit  = 1 << 30
+		window = 10 * time.Second
+	)
+
+	clock := newFakeClock()
+	c := New(WithSweepInterval(0), WithClock(clock.now))
+
+	runSteps(t, clock, []algorithmStep{
+		{cost: 1, allowed: true, remaining: limit - 1},
+		{advance: time.Second, cost: 1, allowed: true, remaining: limit - 2},
+		// Первая запись вышла, буфер растёт после перехода через начало
+		{advance: 9 * time.Second, cost: 2, allowed: true, remaining: limit - 3},
+		// Самая старая запись сделана на второй секунде
+		{cost: limit - 2, allowed: false, retryAfter: time.Second},
+	}, func(cost int64) (quota.Result, error) {
+		return c.AppendLog(context.Background(), "key", cost, limit, window)
+	})
+
+	log, ok := valueOf[*slidingLog](c.lookup("key", clock.now()))
+	if !ok {
+		t.Fatal("sliding log not stored")
+	}
+	if n := len(log.entries); n > 4 {
+		t.Fatalf("buffer holds %d entries, want at most 4", n)
+	}
+}
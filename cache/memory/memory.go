@@ -0,0 +1,396 @@
+// Package memory provides in-memory Cache implementations
+// for the rate limiter: a single-mutex Cache and a hash-partitioned
+// Sharded cache for high-throughput deployments.
+//
+// Both support fixed-window (including batched and all-or-nothing
+// multi-key increments), token-bucket, sliding-window-counter, GCRA
+// and sliding-log semantics, and are intended for testing or
+// single-instance deployments.
+package memory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// DefaultSweepInterval is the default interval between
+// background sweeps of expired entries.
+const DefaultSweepInterval = time.Minute
+
+// Cache is an in-memory Cache implementation.
+//
+// It provides atomic semantics for every supported algorithm using a mutex.
+//
+// Expired entries are evicted by a background janitor goroutine,
+// which must be stopped with Close. Optionally the number of keys
+// can be capped, evicting the least recently used key on overflow.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front — most recently used
+
+	now           func() time.Time
+	maxKeys       int
+	sweepInterval time.Duration
+	evicted       uint64
+	expired       uint64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// entry is a single key stored in the cache.
+//
+// value holds the algorithm-specific state: *fixedWindow, *tokenBucket,
+// *slidingWindow, *gcraState or *slidingLog.
+type entry struct {
+	key      string
+	expireAt time.Time // zero — never expires
+	value    any
+}
+
+// fixedWindow holds the state of a fixed-window counter.
+type fixedWindow struct {
+	count int64
+}
+
+// Option configures Cache.
+type Option func(*Cache)
+
+// WithClock sets the time source of the cache.
+//
+// Defaults to time.Now. Useful for deterministic tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+// WithSweepInterval sets the interval between background sweeps
+// of expired entries. A non-positive interval disables the janitor,
+// in which case expired entries are only replaced on access.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(c *Cache) {
+		c.sweepInterval = interval
+	}
+}
+
+// WithMaxKeys caps the number of stored keys. When the cap is exceeded,
+// the least recently used key is evicted, which resets its limit.
+// A non-positive value means no cap.
+func WithMaxKeys(maxKeys int) Option {
+	return func(c *Cache) {
+		c.maxKeys = maxKeys
+	}
+}
+
+// Stats describes the current state of a cache.
+type Stats struct {
+	// Keys is the number of currently stored keys.
+	Keys int
+	// Expired is the number of keys removed after expiration.
+	Expired uint64
+	// Evicted is the number of live keys evicted to respect the key cap.
+	Evicted uint64
+}
+
+// New creates a new in-memory cache instance
+// and starts its janitor goroutine.
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+		now:           time.Now,
+		sweepInterval: DefaultSweepInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.sweepInterval > 0 {
+		go c.janitor()
+	} else {
+		close(c.done)
+	}
+
+	return c
+}
+
+// Close stops the janitor goroutine. It is safe to call Close
+// multiple times. The cache remains usable after Close,
+// but expired entries are no longer swept in the background.
+func (c *Cache) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+
+	return nil
+}
+
+// Stats returns the current key count and eviction counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Keys:    len(c.entries),
+		Expired: c.expired,
+		Evicted: c.evicted,
+	}
+}
+
+// Increment atomically increments the counter for the given key.
+//
+// If the key is new or expired, the counter starts from 1
+// and the TTL is set to now + window.
+// Otherwise, the counter is incremented without modifying TTL.
+func (c *Cache) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, _, err := c.IncrementBy(ctx, key, 1, window)
+	return count, err
+}
+
+// IncrementWithTTL behaves like Increment and additionally
+// returns the time left until the key expires.
+func (c *Cache) IncrementWithTTL(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	return c.IncrementBy(ctx, key, 1, window)
+}
+
+// IncrementBy behaves like IncrementWithTTL,
+// incrementing the counter by cost instead of one.
+func (c *Cache) IncrementBy(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count, ttl := c.increment(key, window, cost, c.now())
+
+	return count, ttl, nil
+}
+
+// IncrementMulti increments every counter independently
+// under a single lock acquisition.
+func (c *Cache) IncrementMulti(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	results := make([]quota.Result, 0, len(counters))
+	for _, counter := range counters {
+		count, ttl := c.increment(counter.Key, counter.Window, counter.Amount(), now)
+
+		res := quota.Result{
+			Allowed:    count <= counter.Limit,
+			Remaining:  max(0, counter.Limit-count),
+			ResetAfter: ttl,
+		}
+		if !res.Allowed {
+			res.RetryAfter = ttl
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
+
+// IncrementAll atomically increments all counters if every one of them
+// stays within its limit, and leaves all of them untouched otherwise.
+//
+// Expired counters are reset before the check. One result is returned
+// per counter; a counter is reported as allowed if it alone would stay
+// within its limit.
+func (c *Cache) IncrementAll(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return incrementAll(counters, func(string) *Cache { return c }, c.now()), nil
+}
+
+// incrementAll implements IncrementAll over counters that may live
+// in different caches, selected by shardOf.
+//
+// The caller must hold the locks of all involved caches.
+func incrementAll(counters []quota.Counter, shardOf func(key string) *Cache, now time.Time) []quota.Result {
+	// Сначала проверяем все счётчики, ничего не изменяя
+	counts := make([]int64, len(counters))
+	allowed := true
+	for i, counter := range counters {
+		if fw, ok := valueOf[*fixedWindow](shardOf(counter.Key).lookup(counter.Key, now)); ok {
+			counts[i] = fw.count
+		}
+
+		if counts[i]+counter.Amount() > counter.Limit {
+			allowed = false
+		}
+	}
+
+	results := make([]quota.Result, 0, len(counters))
+	for i, counter := range counters {
+		shard := shardOf(counter.Key)
+		count := counts[i]
+		counterAllowed := count+counter.Amount() <= counter.Limit
+		resetAfter := counter.Window
+
+		if allowed {
+			count, resetAfter = shard.increment(counter.Key, counter.Window, counter.Amount(), now)
+		} else if e := shard.lookup(counter.Key, now); e != nil && !e.expireAt.IsZero() {
+			resetAfter = e.expireAt.Sub(now)
+		}
+
+		res := quota.Result{
+			Allowed:    counterAllowed,
+			Remaining:  max(0, counter.Limit-count),
+			ResetAfter: resetAfter,
+		}
+		if !counterAllowed {
+			res.RetryAfter = resetAfter
+		}
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// increment applies fixed-window increment semantics to the given key,
+// adding cost, and returns the new count and the time left until
+// the key expires.
+//
+// The caller must hold c.mu.
+func (c *Cache) increment(key string, window time.Duration, cost int64, now time.Time) (int64, time.Duration) {
+	// Если ключ новый (или был удалён после expiration), начинаем новое окно
+	e := c.lookup(key, now)
+	fw, ok := valueOf[*fixedWindow](e)
+	if !ok {
+		fw = &fixedWindow{}
+		e = c.store(key, fw)
+		if window > 0 {
+			e.expireAt = now.Add(window)
+		}
+	}
+
+	// TTL не продлевается при последующих инкрементах
+	fw.count += cost
+
+	if e.expireAt.IsZero() {
+		return fw.count, window
+	}
+
+	return fw.count, e.expireAt.Sub(now)
+}
+
+// lookup returns the live entry for the given key and marks it
+// as most recently used. Expired entries are removed and nil is returned.
+//
+// The caller must hold c.mu.
+func (c *Cache) lookup(key string, now time.Time) *entry {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	e := elem.Value.(*entry)
+	if !e.expireAt.IsZero() && now.After(e.expireAt) {
+		c.remove(elem)
+		c.expired++
+
+		return nil
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return e
+}
+
+// store inserts a new entry for the given key, replacing any existing one,
+// and evicts the least recently used entries if the key cap is exceeded.
+//
+// The caller must hold c.mu.
+func (c *Cache) store(key string, value any) *entry {
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	e := &entry{key: key, value: value}
+	c.entries[key] = c.lru.PushFront(e)
+
+	for c.maxKeys > 0 && c.lru.Len() > c.maxKeys {
+		c.remove(c.lru.Back())
+		c.evicted++
+	}
+
+	return e
+}
+
+// remove deletes the given element from the cache.
+//
+// The caller must hold c.mu.
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).key)
+}
+
+// janitor periodically sweeps expired entries until Close is called.
+func (c *Cache) janitor() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.sweep(c.now())
+		}
+	}
+}
+
+// sweep removes all entries that expired before now.
+func (c *Cache) sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, elem := range c.entries {
+		e := elem.Value.(*entry)
+		if !e.expireAt.IsZero() && now.After(e.expireAt) {
+			c.remove(elem)
+			c.expired++
+		}
+	}
+}
+
+// valueOf returns the state stored in the entry if it has the expected type.
+//
+// A nil entry or a state of another type (the key was used
+// with a different algorithm) yields false.
+func valueOf[T any](e *entry) (T, bool) {
+	var zero T
+	if e == nil {
+		return zero, false
+	}
+
+	v, ok := e.value.(T)
+
+	return v, ok
+}
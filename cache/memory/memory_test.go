@@ -0,0 +1,194 @@
+package memory_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/cache/memory"
+	"github.com/murouse/rate-limiter/cachetest"
+)
+
+func TestCacheConformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		c := memory.New()
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c
+	})
+}
+
+func TestShardedConformance(t *testing.T) {
+	cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+		c := memory.NewSharded(8)
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c
+	})
+}
+
+func TestCacheAlgorithms(t *testing.T) {
+	cachetest.RunAlgorithms(t, func(t *testing.T) (ratelimiter.Cache, func(time.Duration)) {
+		now := time.Unix(1700000000, 0)
+		c := memory.New(memory.WithClock(func() time.Time { return now }))
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c, func(d time.Duration) { now = now.Add(d) }
+	})
+}
+
+func TestShardedAlgorithms(t *testing.T) {
+	cachetest.RunAlgorithms(t, func(t *testing.T) (ratelimiter.Cache, func(time.Duration)) {
+		now := time.Unix(1700000000, 0)
+		c := memory.NewSharded(8, memory.WithClock(func() time.Time { return now }))
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c, func(d time.Duration) { now = now.Add(d) }
+	})
+}
+
+// atomicClock is a manually advanced time source
+// safe to read from the janitor goroutine.
+type atomicClock struct {
+	nanos atomic.Int64
+}
+
+func newAtomicClock() *atomicClock {
+	c := &atomicClock{}
+	c.nanos.Store(time.Unix(1700000000, 0).UnixNano())
+
+	return c
+}
+
+func (c *atomicClock) now() time.Time {
+	return time.Unix(0, c.nanos.Load())
+}
+
+func (c *atomicClock) advance(d time.Duration) {
+	c.nanos.Add(int64(d))
+}
+
+// mustIncrement increments the key and fails the test
+// unless the returned count equals want.
+func mustIncrement(t *testing.T, c *memory.Cache, key string, want int64) {
+	t.Helper()
+
+	got, err := c.Increment(context.Background(), key, time.Second)
+	if err != nil {
+		t.Fatalf("Increment(%q): %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Increment(%q) = %d, want %d", key, got, want)
+	}
+}
+
+// TestMaxKeysEvictsLeastRecentlyUsed checks that the key cap
+// is respected and the least recently used key is evicted first.
+func TestMaxKeysEvictsLeastRecentlyUsed(t *testing.T) {
+	c := memory.New(memory.WithSweepInterval(0), memory.WithMaxKeys(2))
+
+	mustIncrement(t, c, "a", 1)
+	mustIncrement(t, c, "b", 1)
+	mustIncrement(t, c, "a", 2)
+
+	// Ключ b использовался давнее a и вытесняется первым
+	mustIncrement(t, c, "c", 1)
+	if stats := c.Stats(); stats != (memory.Stats{Keys: 2, Evicted: 1}) {
+		t.Fatalf("Stats() = %+v, want 2 keys and 1 eviction", stats)
+	}
+
+	mustIncrement(t, c, "a", 3)
+	mustIncrement(t, c, "b", 1)
+	mustIncrement(t, c, "a", 4)
+	if stats := c.Stats(); stats != (memory.Stats{Keys: 2, Evicted: 2}) {
+		t.Fatalf("Stats() = %+v, want 2 keys and 2 evictions", stats)
+	}
+}
+
+// TestExpiredOnAccess checks that an expired key accessed before
+// the janitor sweeps it starts a new window and is counted as expired.
+func TestExpiredOnAccess(t *testing.T) {
+	clock := newAtomicClock()
+	c := memory.New(memory.WithSweepInterval(0), memory.WithClock(clock.now))
+
+	mustIncrement(t, c, "key", 1)
+	mustIncrement(t, c, "key", 2)
+
+	clock.advance(2 * time.Second)
+	mustIncrement(t, c, "key", 1)
+
+	if stats := c.Stats(); stats != (memory.Stats{Keys: 1, Expired: 1}) {
+		t.Fatalf("Stats() = %+v, want 1 key and 1 expiration", stats)
+	}
+}
+
+// TestJanitor checks that the janitor sweeps expired keys
+// in the background and stops sweeping once the cache is closed.
+func TestJanitor(t *testing.T) {
+	const sweepInterval = time.Millisecond
+
+	clock := newAtomicClock()
+	c := memory.New(memory.WithSweepInterval(sweepInterval), memory.WithClock(clock.now))
+
+	mustIncrement(t, c, "expiring", 1)
+	if _, _, err := c.IncrementBy(context.Background(), "live", 1, time.Hour); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+
+	clock.advance(2 * time.Second)
+	waitForStats(t, c, memory.Stats{Keys: 1, Expired: 1})
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// Повторный вызов Close безопасен
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	clock.advance(2 * time.Hour)
+	time.Sleep(20 * sweepInterval)
+	if stats := c.Stats(); stats != (memory.Stats{Keys: 1, Expired: 1}) {
+		t.Fatalf("Stats() after Close = %+v, want the expired key kept", stats)
+	}
+}
+
+// waitForStats waits until the cache reports the wanted stats.
+func waitForStats(t *testing.T, c *memory.Cache, want memory.Stats) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := c.Stats()
+		if stats == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats() = %+v, want %+v", stats, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestShardedStats checks that Sharded sums the stats of its shards.
+func TestShardedStats(t *testing.T) {
+	clock := newAtomicClock()
+	c := memory.NewSharded(4, memory.WithSweepInterval(0), memory.WithClock(clock.now))
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := c.Increment(context.Background(), key, time.Second); err != nil {
+			t.Fatalf("Increment(%q): %v", key, err)
+		}
+	}
+
+	clock.advance(2 * time.Second)
+	if _, err := c.Increment(context.Background(), "a", time.Second); err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+
+	if stats := c.Stats(); stats != (memory.Stats{Keys: 5, Expired: 1}) {
+		t.Fatalf("Stats() = %+v, want 5 keys and 1 expiration", stats)
+	}
+}
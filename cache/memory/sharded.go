@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// Sharded is an in-memory Cache partitioned into shards.
+//
+// Keys are distributed across independent Cache shards by hash,
+// so concurrent requests for different keys rarely contend on the same
+// mutex. It supports the same algorithms as Cache; all-or-nothing
+// increments lock every involved shard in a fixed order.
+type Sharded struct {
+	shards []*Cache
+	seed   maphash.Seed
+}
+
+// NewSharded creates a cache with the given number of shards.
+//
+// The options are applied to every shard, so WithMaxKeys caps
+// the number of keys per shard. A non-positive shard count
+// falls back to a single shard.
+func NewSharded(shards int, opts ...Option) *Sharded {
+	shards = max(shards, 1)
+
+	c := &Sharded{
+		shards: make([]*Cache, shards),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i] = New(opts...)
+	}
+
+	return c
+}
+
+// Close stops the janitors of all shards.
+func (c *Sharded) Close() error {
+	var errs []error
+	for _, shard := range c.shards {
+		errs = append(errs, shard.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns the key count and eviction counters summed over all shards.
+func (c *Sharded) Stats() Stats {
+	var stats Stats
+	for _, shard := range c.shards {
+		s := shard.Stats()
+		stats.Keys += s.Keys
+		stats.Expired += s.Expired
+		stats.Evicted += s.Evicted
+	}
+
+	return stats
+}
+
+// Increment atomically increments the counter for the given key
+// in the shard owning the key.
+func (c *Sharded) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return c.shard(key).Increment(ctx, key, window)
+}
+
+// IncrementWithTTL behaves like Increment and additionally
+// returns the time left until the key expires.
+func (c *Sharded) IncrementWithTTL(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	return c.shard(key).IncrementWithTTL(ctx, key, window)
+}
+
+// IncrementBy increments the counter for the given key by cost
+// in the shard owning the key.
+func (c *Sharded) IncrementBy(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error) {
+	return c.shard(key).IncrementBy(ctx, key, cost, window)
+}
+
+// IncrementMulti increments every counter independently,
+// with one lock acquisition per involved shard.
+func (c *Sharded) IncrementMulti(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	groups := lo.GroupBy(lo.Range(len(counters)), func(i int) int {
+		return c.shardIndex(counters[i].Key)
+	})
+
+	results := make([]quota.Result, len(counters))
+	for shardIndex, group := range groups {
+		res, err := c.shards[shardIndex].IncrementMulti(ctx, lo.Map(group, func(i int, _ int) quota.Counter {
+			return counters[i]
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range group {
+			results[i] = res[j]
+		}
+	}
+
+	return results, nil
+}
+
+// IncrementAll atomically increments all counters if every one of them
+// stays within its limit, and leaves all of them untouched otherwise.
+//
+// All involved shards are locked in ascending order for the duration
+// of the operation, so concurrent calls cannot deadlock.
+func (c *Sharded) IncrementAll(ctx context.Context, counters []quota.Counter) ([]quota.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	shardIndexes := lo.Uniq(lo.Map(counters, func(counter quota.Counter, _ int) int {
+		return c.shardIndex(counter.Key)
+	}))
+	slices.Sort(shardIndexes)
+
+	for _, i := range shardIndexes {
+		c.shards[i].mu.Lock()
+		defer c.shards[i].mu.Unlock()
+	}
+
+	return incrementAll(counters, c.shard, c.shards[0].now()), nil
+}
+
+// TakeToken takes tokens from the bucket stored in the shard owning the key.
+func (c *Sharded) TakeToken(ctx context.Context, key string, cost, capacity int64, refillInterval time.Duration) (quota.Result, error) {
+	return c.shard(key).TakeToken(ctx, key, cost, capacity, refillInterval)
+}
+
+// IncrementSliding increments the sliding window counter
+// stored in the shard owning the key.
+func (c *Sharded) IncrementSliding(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error) {
+	return c.shard(key).IncrementSliding(ctx, key, cost, window)
+}
+
+// AllowGCRA evaluates the request against the TAT
+// stored in the shard owning the key.
+func (c *Sharded) AllowGCRA(ctx context.Context, key string, cost int64, emissionInterval time.Duration, burst int64) (quota.Result, error) {
+	return c.shard(key).AllowGCRA(ctx, key, cost, emissionInterval, burst)
+}
+
+// AppendLog records the request in the sliding log
+// stored in the shard owning the key.
+func (c *Sharded) AppendLog(ctx context.Context, key string, cost, limit int64, window time.Duration) (quota.Result, error) {
+	return c.shard(key).AppendLog(ctx, key, cost, limit, window)
+}
+
+// shard returns the shard owning the given key.
+func (c *Sharded) shard(key string) *Cache {
+	return c.shards[c.shardIndex(key)]
+}
+
+// shardIndex returns the index of the shard owning the given key.
+func (c *Sharded) shardIndex(key string) int {
+	return int(maphash.String(c.seed, key) % uint64(len(c.shards)))
+}
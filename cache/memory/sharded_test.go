@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchmarkGoroutines is the minimum number of goroutines
+// incrementing concurrently in the contention benchmarks.
+const benchmarkGoroutines = 64
+
+// incrementer is the part of Cache and Sharded used by the benchmarks.
+type incrementer interface {
+	IncrementWithTTL(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// BenchmarkContention compares Cache with Sharded under at least
+// benchmarkGoroutines concurrent callers, incrementing either
+// distinct keys or one hot key.
+func BenchmarkContention(b *testing.B) {
+	caches := []struct {
+		name string
+		new  func() incrementer
+	}{
+		{"Cache", func() incrementer { return New(WithSweepInterval(0)) }},
+		{"Sharded", func() incrementer { return NewSharded(64, WithSweepInterval(0)) }},
+	}
+
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+
+	for _, cache := range caches {
+		b.Run(cache.name+"/DistinctKeys", func(b *testing.B) {
+			benchmarkIncrement(b, cache.new(), func(i uint64) string { return keys[i%uint64(len(keys))] })
+		})
+		b.Run(cache.name+"/HotKey", func(b *testing.B) {
+			benchmarkIncrement(b, cache.new(), func(uint64) string { return "hot" })
+		})
+	}
+}
+
+// benchmarkIncrement increments the keys returned by keyOf
+// from benchmarkGoroutines goroutines per GOMAXPROCS.
+func benchmarkIncrement(b *testing.B, cache incrementer, keyOf func(i uint64) string) {
+	var next atomic.Uint64
+
+	b.ReportAllocs()
+	b.SetParallelism(benchmarkGoroutines)
+	b.RunParallel(func(pb *testing.PB) {
+		// Каждая горутина начинает со своего ключа, чтобы не идти по ключам синхронно
+		i := next.Add(1) * 7919
+		for pb.Next() {
+			if _, _, err := cache.IncrementWithTTL(context.Background(), keyOf(i), time.Minute); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
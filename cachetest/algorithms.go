@@ -0,0 +1,131 @@
+package cachetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// ClockFactory creates the Cache under test together with a function
+// advancing the clock the cache reads the current time from.
+//
+// It is called once per check. The clock only moves when advanced,
+// so the checks can assert exact retry delays.
+type ClockFactory func(t *testing.T) (cache ratelimiter.Cache, advance func(d time.Duration))
+
+// RunAlgorithms runs deterministic checks of the algorithm interfaces
+// implemented by caches created by factory. Checks of interfaces
+// a cache does not implement are skipped.
+func RunAlgorithms(t *testing.T, factory ClockFactory) {
+	t.Helper()
+
+	t.Run("TokenBucket", func(t *testing.T) {
+		testTokenBucket(t, factory)
+	})
+	t.Run("GCRA", func(t *testing.T) {
+		testGCRA(t, factory)
+	})
+}
+
+// algorithmStep is one request of an algorithm check: the clock is
+// advanced, a request of cost units is made and its result is checked.
+type algorithmStep struct {
+	advance    time.Duration
+	cost       int64
+	allowed    bool
+	remaining  int64
+	retryAfter time.Duration
+}
+
+// runSteps makes the requests of steps with call and checks
+// their Allowed, Remaining and RetryAfter values.
+func runSteps(t *testing.T, advance func(time.Duration), steps []algorithmStep, call func(cost int64) (quota.Result, error)) {
+	t.Helper()
+
+	for i, step := range steps {
+		advance(step.advance)
+
+		res, err := call(step.cost)
+		if err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+		if res.Allowed != step.allowed || res.Remaining != step.remaining || res.RetryAfter != step.retryAfter {
+			t.Fatalf("step %d of %d units: got allowed=%t remaining=%d retry=%s, want allowed=%t remaining=%d retry=%s",
+				i+1, step.cost, res.Allowed, res.Remaining, res.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+		}
+	}
+}
+
+func testTokenBucket(t *testing.T, factory ClockFactory) {
+	cache, advance := factory(t)
+
+	tokenBucketCache, ok := cache.(ratelimiter.TokenBucketCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.TokenBucketCache")
+	}
+
+	const (
+		capacity = 3
+		interval = time.Second
+	)
+
+	key := testKey(t, "key")
+
+	runSteps(t, advance, []algorithmStep{
+		// Новый бакет полон
+		{cost: 1, allowed: true, remaining: 2},
+		{cost: 2, allowed: true, remaining: 0},
+		{cost: 1, allowed: false, remaining: 0, retryAfter: interval},
+		// Полтокена уже набралось
+		{advance: interval / 2, cost: 1, allowed: false, remaining: 0, retryAfter: interval / 2},
+		{advance: interval / 2, cost: 1, allowed: true, remaining: 0},
+		// Бакет наполняется не больше чем до ёмкости
+		{advance: 10 * interval, cost: capacity, allowed: true, remaining: 0},
+		{advance: 2 * interval, cost: capacity, allowed: false, remaining: 2, retryAfter: interval},
+		// Запрос дороже ёмкости ждёт наполнения всего бакета
+		{cost: capacity + 1, allowed: false, remaining: 2, retryAfter: capacity * interval},
+		{cost: 2, allowed: true, remaining: 0},
+	}, func(cost int64) (quota.Result, error) {
+		return tokenBucketCache.TakeToken(context.Background(), key, cost, capacity, interval)
+	})
+}
+
+func testGCRA(t *testing.T, factory ClockFactory) {
+	cache, advance := factory(t)
+
+	gcraCache, ok := cache.(ratelimiter.GCRACache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.GCRACache")
+	}
+
+	const (
+		burst    = 3
+		interval = time.Second
+	)
+
+	key := testKey(t, "key")
+
+	runSteps(t, advance, []algorithmStep{
+		// Всплеск до burst запросов проходит сразу
+		{cost: 1, allowed: true, remaining: 2},
+		{cost: 1, allowed: true, remaining: 1},
+		{cost: 1, allowed: true, remaining: 0},
+		{cost: 1, allowed: false, remaining: 0, retryAfter: interval},
+		{advance: interval / 2, cost: 1, allowed: false, remaining: 0, retryAfter: interval / 2},
+		// После всплеска запросы проходят не чаще одного за интервал
+		{advance: interval / 2, cost: 1, allowed: true, remaining: 0},
+		{advance: interval / 2, cost: 1, allowed: false, remaining: 0, retryAfter: interval / 2},
+		{advance: interval / 2, cost: 1, allowed: true, remaining: 0},
+		// Простой восстанавливает весь всплеск, но не больше
+		{advance: 10 * interval, cost: burst, allowed: true, remaining: 0},
+		{advance: interval, cost: 2, allowed: false, remaining: 0, retryAfter: interval},
+		// Запрос дороже всплеска ждёт восстановления всего всплеска
+		{cost: burst + 1, allowed: false, remaining: 0, retryAfter: burst * interval},
+		{advance: interval, cost: 2, allowed: true, remaining: 0},
+	}, func(cost int64) (quota.Result, error) {
+		return gcraCache.AllowGCRA(context.Background(), key, cost, interval, burst)
+	})
+}
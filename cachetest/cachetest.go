@@ -0,0 +1,395 @@
+// Package cachetest provides a conformance test suite
+// for ratelimiter.Cache implementations.
+//
+// Any storage backend can prove that it satisfies the fixed-window
+// contract documented on ratelimiter.Cache by running the suite
+// from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		cachetest.RunConformance(t, func(t *testing.T) ratelimiter.Cache {
+//			return NewMyCache()
+//		})
+//	}
+//
+// Caches implementing the algorithm extensions can additionally run
+// RunAlgorithms with a clock the test controls.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ratelimiter "github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// Window is the default fixed window used by time-dependent checks.
+//
+// It is short enough to keep the suite fast and long enough
+// to tolerate a network round trip to a real backend.
+const Window = 300 * time.Millisecond
+
+// Concurrency is the number of goroutines used by the concurrency check,
+// each of which increments the same key Concurrency times.
+const Concurrency = 32
+
+// Factory creates the Cache under test.
+//
+// It is called once per check. Caches may share storage between calls:
+// every check uses its own keys.
+type Factory func(t *testing.T) ratelimiter.Cache
+
+// Option configures RunConformance.
+type Option func(*config)
+
+type config struct {
+	window time.Duration
+}
+
+// WithWindow sets the fixed window used by time-dependent checks.
+//
+// Defaults to Window. Backends with coarser expiry resolution,
+// such as memcached (whole seconds), need a longer window.
+func WithWindow(window time.Duration) Option {
+	return func(cfg *config) {
+		cfg.window = window
+	}
+}
+
+// RunConformance runs the fixed-window conformance checks
+// against caches created by factory.
+func RunConformance(t *testing.T, factory Factory, opts ...Option) {
+	t.Helper()
+
+	cfg := config{window: Window}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	t.Run("FirstIncrementReturnsOne", func(t *testing.T) {
+		testFirstIncrementReturnsOne(t, factory(t))
+	})
+	t.Run("IncrementsSequentially", func(t *testing.T) {
+		testIncrementsSequentially(t, factory(t))
+	})
+	t.Run("KeysAreIndependent", func(t *testing.T) {
+		testKeysAreIndependent(t, factory(t))
+	})
+	t.Run("TTLNotExtended", func(t *testing.T) {
+		testTTLNotExtended(t, factory(t), cfg.window)
+	})
+	t.Run("ExpiryResetsCounter", func(t *testing.T) {
+		testExpiryResetsCounter(t, factory(t), cfg.window)
+	})
+	t.Run("TTLReported", func(t *testing.T) {
+		testTTLReported(t, factory(t))
+	})
+	t.Run("IncrementBy", func(t *testing.T) {
+		testIncrementBy(t, factory(t))
+	})
+	t.Run("ConcurrentIncrements", func(t *testing.T) {
+		testConcurrentIncrements(t, factory(t))
+	})
+	t.Run("CanceledContext", func(t *testing.T) {
+		testCanceledContext(t, factory(t))
+	})
+	t.Run("IncrementMulti", func(t *testing.T) {
+		testIncrementMulti(t, factory(t))
+	})
+	t.Run("IncrementAll", func(t *testing.T) {
+		testIncrementAll(t, factory(t))
+	})
+	t.Run("Reserve", func(t *testing.T) {
+		testReserve(t, factory(t))
+	})
+}
+
+func testFirstIncrementReturnsOne(t *testing.T, cache ratelimiter.Cache) {
+	key := testKey(t, "key")
+
+	mustIncrement(t, cache, key, time.Minute, 1)
+}
+
+func testIncrementsSequentially(t *testing.T, cache ratelimiter.Cache) {
+	key := testKey(t, "key")
+
+	for want := int64(1); want <= 5; want++ {
+		mustIncrement(t, cache, key, time.Minute, want)
+	}
+}
+
+func testKeysAreIndependent(t *testing.T, cache ratelimiter.Cache) {
+	first, second := testKey(t, "first"), testKey(t, "second")
+
+	mustIncrement(t, cache, first, time.Minute, 1)
+	mustIncrement(t, cache, first, time.Minute, 2)
+	mustIncrement(t, cache, second, time.Minute, 1)
+}
+
+// testTTLNotExtended increments a key twice within one window and once more
+// after the window set by the first increment has passed. With fixed-window
+// semantics the last increment starts a new window; an implementation that
+// extends the TTL on every increment would return 3.
+func testTTLNotExtended(t *testing.T, cache ratelimiter.Cache, window time.Duration) {
+	key := testKey(t, "key")
+
+	mustIncrement(t, cache, key, window, 1)
+	time.Sleep(window * 2 / 3)
+	mustIncrement(t, cache, key, window, 2)
+	time.Sleep(window * 2 / 3)
+	mustIncrement(t, cache, key, window, 1)
+}
+
+func testExpiryResetsCounter(t *testing.T, cache ratelimiter.Cache, window time.Duration) {
+	key := testKey(t, "key")
+
+	mustIncrement(t, cache, key, window, 1)
+	mustIncrement(t, cache, key, window, 2)
+	time.Sleep(window + window/3)
+	mustIncrement(t, cache, key, window, 1)
+}
+
+// testTTLReported checks the optional TTLCache extension: the reported TTL
+// must stay within the window and must not grow on later increments.
+func testTTLReported(t *testing.T, cache ratelimiter.Cache) {
+	ttlCache, ok := cache.(ratelimiter.TTLCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.TTLCache")
+	}
+
+	key := testKey(t, "key")
+
+	_, first, err := ttlCache.IncrementWithTTL(context.Background(), key, time.Minute)
+	if err != nil {
+		t.Fatalf("IncrementWithTTL: %v", err)
+	}
+	if first <= 0 || first > time.Minute {
+		t.Fatalf("IncrementWithTTL: ttl %s out of (0, %s]", first, time.Minute)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, second, err := ttlCache.IncrementWithTTL(context.Background(), key, time.Minute)
+	if err != nil {
+		t.Fatalf("IncrementWithTTL: %v", err)
+	}
+	if second > first {
+		t.Fatalf("IncrementWithTTL: ttl extended from %s to %s", first, second)
+	}
+}
+
+// testIncrementBy checks the optional CostCache extension: the counter
+// grows by the cost and shares its value with Increment.
+func testIncrementBy(t *testing.T, cache ratelimiter.Cache) {
+	costCache, ok := cache.(ratelimiter.CostCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.CostCache")
+	}
+
+	key := testKey(t, "key")
+
+	for i, step := range []struct{ cost, want int64 }{{3, 3}, {5, 8}} {
+		got, ttl, err := costCache.IncrementBy(context.Background(), key, step.cost, time.Minute)
+		if err != nil {
+			t.Fatalf("IncrementBy #%d: %v", i+1, err)
+		}
+		if got != step.want {
+			t.Fatalf("IncrementBy(%q, %d) = %d, want %d", key, step.cost, got, step.want)
+		}
+		if ttl <= 0 || ttl > time.Minute {
+			t.Fatalf("IncrementBy #%d: ttl %s out of (0, %s]", i+1, ttl, time.Minute)
+		}
+	}
+
+	mustIncrement(t, cache, key, time.Minute, 9)
+}
+
+// testConcurrentIncrements increments one key from many goroutines at once.
+// Increments must be atomic: every returned count is unique and the counts
+// cover 1..n without gaps.
+func testConcurrentIncrements(t *testing.T, cache ratelimiter.Cache) {
+	key := testKey(t, "key")
+	total := Concurrency * Concurrency
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		seen   = make(map[int64]bool, total)
+		errs   []error
+		worker = func() {
+			defer wg.Done()
+
+			for i := 0; i < Concurrency; i++ {
+				count, err := cache.Increment(context.Background(), key, time.Minute)
+
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					if seen[count] {
+						errs = append(errs, errors.New("duplicate count"))
+					}
+					seen[count] = true
+				}
+				mu.Unlock()
+			}
+		}
+	)
+
+	wg.Add(Concurrency)
+	for i := 0; i < Concurrency; i++ {
+		go worker()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("concurrent Increment(%q): %v", key, errors.Join(errs...))
+	}
+	for want := int64(1); want <= int64(total); want++ {
+		if !seen[want] {
+			t.Fatalf("concurrent Increment(%q): count %d never returned", key, want)
+		}
+	}
+
+	mustIncrement(t, cache, key, time.Minute, int64(total)+1)
+}
+
+// testCanceledContext checks that a canceled context is reported
+// as an error wrapping context.Canceled and that the key is not incremented.
+func testCanceledContext(t *testing.T, cache ratelimiter.Cache) {
+	key := testKey(t, "key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cache.Increment(ctx, key, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Increment(%q) with canceled context: err = %v, want context.Canceled", key, err)
+	}
+
+	mustIncrement(t, cache, key, time.Minute, 1)
+}
+
+// testIncrementMulti checks the optional BatchCache extension:
+// counters are incremented independently and report their limits.
+func testIncrementMulti(t *testing.T, cache ratelimiter.Cache) {
+	batchCache, ok := cache.(ratelimiter.BatchCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.BatchCache")
+	}
+
+	first, second := testKey(t, "first"), testKey(t, "second")
+	counters := []quota.Counter{
+		{Key: first, Window: time.Minute, Limit: 1},
+		{Key: second, Window: time.Minute, Limit: 2},
+	}
+
+	for i, want := range [][]bool{{true, true}, {false, true}, {false, false}} {
+		results, err := batchCache.IncrementMulti(context.Background(), counters)
+		if err != nil {
+			t.Fatalf("IncrementMulti #%d: %v", i+1, err)
+		}
+		if len(results) != len(counters) {
+			t.Fatalf("IncrementMulti #%d: %d results, want %d", i+1, len(results), len(counters))
+		}
+		for j, result := range results {
+			if result.Allowed != want[j] {
+				t.Fatalf("IncrementMulti #%d: counter %q allowed = %t, want %t", i+1, counters[j].Key, result.Allowed, want[j])
+			}
+		}
+	}
+
+	// Счётчики увеличиваются и при отказе, как в Increment
+	mustIncrement(t, cache, first, time.Minute, 4)
+}
+
+// testIncrementAll checks the optional AtomicCache extension:
+// when one counter exceeds its limit, no counter is incremented.
+func testIncrementAll(t *testing.T, cache ratelimiter.Cache) {
+	atomicCache, ok := cache.(ratelimiter.AtomicCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.AtomicCache")
+	}
+
+	first, second := testKey(t, "first"), testKey(t, "second")
+	counters := []quota.Counter{
+		{Key: first, Window: time.Minute, Limit: 2},
+		{Key: second, Window: time.Minute, Limit: 1},
+	}
+
+	for i, want := range []bool{true, false} {
+		results, err := atomicCache.IncrementAll(context.Background(), counters)
+		if err != nil {
+			t.Fatalf("IncrementAll #%d: %v", i+1, err)
+		}
+		if len(results) != len(counters) {
+			t.Fatalf("IncrementAll #%d: %d results, want %d", i+1, len(results), len(counters))
+		}
+		if allowed := results[0].Allowed && results[1].Allowed; allowed != want {
+			t.Fatalf("IncrementAll #%d: allowed = %t, want %t", i+1, allowed, want)
+		}
+	}
+
+	// Отклонённый вызов не должен был изменить ни один счётчик
+	mustIncrement(t, cache, first, time.Minute, 2)
+}
+
+func testReserve(t *testing.T, cache ratelimiter.Cache) {
+	quotaCache, ok := cache.(ratelimiter.QuotaCache)
+	if !ok {
+		t.Skip("cache does not implement ratelimiter.QuotaCache")
+	}
+
+	key := testKey(t, "key")
+
+	// Отклонённый запрос не должен занимать единицы: после него проходит более дешёвый
+	steps := []struct {
+		cost    int64
+		allowed bool
+	}{
+		{cost: 2, allowed: true},
+		{cost: 2, allowed: false},
+		{cost: 1, allowed: true},
+		{cost: 1, allowed: false},
+	}
+	for i, step := range steps {
+		res, err := quotaCache.Reserve(context.Background(), quota.Counter{Key: key, Window: time.Minute, Limit: 3, Cost: step.cost})
+		if err != nil {
+			t.Fatalf("Reserve #%d: %v", i+1, err)
+		}
+		if res.Allowed != step.allowed {
+			t.Fatalf("Reserve #%d of %d units: allowed = %t, want %t", i+1, step.cost, res.Allowed, step.allowed)
+		}
+		if res.ResetAfter <= 0 || res.ResetAfter > time.Minute {
+			t.Fatalf("Reserve #%d: reset after %s, want within (0, %s]", i+1, res.ResetAfter, time.Minute)
+		}
+		if !res.Allowed && res.RetryAfter <= 0 {
+			t.Fatalf("Reserve #%d: rejected with retry after %s, want positive", i+1, res.RetryAfter)
+		}
+	}
+}
+
+// mustIncrement increments the key and fails the test
+// unless the returned count equals want.
+func mustIncrement(t *testing.T, cache ratelimiter.Cache, key string, window time.Duration, want int64) {
+	t.Helper()
+
+	got, err := cache.Increment(context.Background(), key, window)
+	if err != nil {
+		t.Fatalf("Increment(%q): %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Increment(%q) = %d, want %d", key, got, want)
+	}
+}
+
+// testKey returns a key unique to the running test,
+// so checks can share one backend without interfering.
+func testKey(t *testing.T, name string) string {
+	t.Helper()
+
+	return "cachetest:" + strings.ReplaceAll(t.Name(), "/", ":") + ":" + name + ":" + time.Now().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,251 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default circuit breaker settings, used for zero CircuitBreakerConfig fields.
+const (
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerOpenTimeout      = 10 * time.Second
+	DefaultCircuitBreakerSuccessThreshold = 1
+)
+
+// CircuitBreakerConfig configures the circuit breaker around the cache.
+//
+// Zero fields take their default values.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed cache calls
+	// that opens the circuit.
+	FailureThreshold int
+	// LatencyThreshold makes successful calls slower than it count
+	// as failures. Zero disables latency tracking.
+	LatencyThreshold time.Duration
+	// OpenTimeout is how long the circuit stays open before
+	// a probe call is let through (half-open state).
+	OpenTimeout time.Duration
+	// SuccessThreshold is the number of consecutive successful probes
+	// that closes the circuit again.
+	SuccessThreshold int
+}
+
+// circuitState is the state of a circuit breaker.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// String returns the state name used in log messages.
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops calling the cache after consecutive failures
+// or slow calls, so requests fail fast under the configured failure policy
+// instead of waiting for a degraded backend.
+//
+// While open, calls are rejected with ErrCircuitOpen. After OpenTimeout
+// a single probe call at a time is let through; SuccessThreshold successful
+// probes close the circuit, a failed probe opens it again.
+type circuitBreaker struct {
+	cfg    CircuitBreakerConfig
+	logger Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	state     circuitState
+	failures  int // подряд неудачных вызовов в закрытом состоянии
+	successes int // подряд успешных проб в полуоткрытом состоянии
+	openedAt  time.Time
+	probing   bool
+}
+
+// newCircuitBreaker creates a closed circuit breaker,
+// filling zero config fields with their defaults.
+func newCircuitBreaker(cfg CircuitBreakerConfig, logger Logger) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultCircuitBreakerFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultCircuitBreakerOpenTimeout
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = DefaultCircuitBreakerSuccessThreshold
+	}
+
+	return &circuitBreaker{
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// do runs fn if the circuit lets the call through
+// and records its outcome. ErrCircuitOpen is returned otherwise.
+//
+// Errors for which isFailure reports false do not indicate a backend
+// problem and leave the circuit state unchanged.
+func (cb *circuitBreaker) do(fn func() error, isFailure func(error) bool) error {
+	ok, probe := cb.allow()
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	start := cb.now()
+	err := fn()
+	if err != nil && !isFailure(err) {
+		cb.release(probe)
+		return err
+	}
+	cb.record(probe, err, cb.now().Sub(start))
+
+	return err
+}
+
+// release ends a call without recording its outcome.
+func (cb *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+}
+
+// allow reports whether a call may proceed and whether it is a probe.
+func (cb *circuitBreaker) allow() (ok, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitOpen {
+		if cb.now().Sub(cb.openedAt) < cb.cfg.OpenTimeout {
+			return false, false
+		}
+		cb.transition(circuitHalfOpen, "open timeout elapsed")
+	}
+
+	if cb.state == circuitHalfOpen {
+		// В полуоткрытом состоянии пропускаем только одну пробу за раз
+		if cb.probing {
+			return false, false
+		}
+		cb.probing = true
+
+		return true, true
+	}
+
+	return true, false
+}
+
+// record updates the circuit state with the outcome of a call.
+func (cb *circuitBreaker) record(probe bool, err error, latency time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.probing = false
+	}
+
+	var reason string
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case cb.cfg.LatencyThreshold > 0 && latency > cb.cfg.LatencyThreshold:
+		reason = fmt.Sprintf("slow call: %s", latency)
+	}
+
+	if probe {
+		if reason != "" {
+			cb.transition(circuitOpen, "probe failed: "+reason)
+			return
+		}
+
+		cb.successes++
+		if cb.successes >= cb.cfg.SuccessThreshold {
+			cb.transition(circuitClosed, "probes succeeded")
+		}
+
+		return
+	}
+
+	// Результаты вызовов, начатых до открытия цепи, не влияют на её состояние
+	if cb.state != circuitClosed {
+		return
+	}
+
+	if reason == "" {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.failures >= cb.cfg.FailureThreshold {
+		cb.transition(circuitOpen, fmt.Sprintf("%d consecutive failures, last: %s", cb.failures, reason))
+	}
+}
+
+// transition moves the circuit to the given state and logs the change.
+// Must be called with cb.mu held.
+func (cb *circuitBreaker) transition(to circuitState, reason string) {
+	from := cb.state
+	cb.state = to
+	cb.failures = 0
+	cb.successes = 0
+
+	if to == circuitOpen {
+		cb.openedAt = cb.now()
+		cb.logger.Warnf("circuit breaker %s -> %s: %s", from, to, reason)
+		return
+	}
+
+	cb.logger.Infof("circuit breaker %s -> %s: %s", from, to, reason)
+}
+
+// callCache runs a call to the configured cache
+// through the circuit breaker, if one is enabled.
+//
+// ctx must be the context the call is made with.
+func (rl *RateLimiter) callCache(ctx context.Context, fn func() error) error {
+	if rl.circuitBreaker == nil {
+		return fn()
+	}
+
+	return rl.circuitBreaker.do(fn, func(err error) bool {
+		return rl.isBackendFailure(ctx, err)
+	})
+}
+
+// isBackendFailure reports whether a cache call error made with ctx
+// indicates a problem with the cache itself.
+//
+// Configuration errors and canceled requests do not. A deadline counts
+// only if it is the limiter's own cache timeout rather than the deadline
+// of the client request.
+func (rl *RateLimiter) isBackendFailure(ctx context.Context, err error) bool {
+	switch {
+	case isConfigError(err), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		// Без WithCacheTimeout контекст вызова — это контекст запроса,
+		// и истёкший дедлайн клиента ничего не говорит о кэше
+		return rl.cacheTimeout > 0 || ctx.Err() == nil
+	default:
+		return true
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// stubCache fails every call with the error returned by fn.
+type stubCache struct {
+	fn func(ctx context.Context) error
+}
+
+func (c stubCache) Increment(ctx context.Context, _ string, _ time.Duration) (int64, error) {
+	return 0, c.fn(ctx)
+}
+
+// TestCircuitBreakerCountedErrors checks which cache errors
+// are counted as backend failures by the circuit breaker.
+func TestCircuitBreakerCountedErrors(t *testing.T) {
+	waitForContext := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name         string
+		fn           func(ctx context.Context) error
+		cacheTimeout time.Duration
+		wantState    circuitState
+	}{
+		{
+			name:      "client deadline",
+			fn:        waitForContext,
+			wantState: circuitClosed,
+		},
+		{
+			name:         "cache timeout",
+			fn:           waitForContext,
+			cacheTimeout: time.Millisecond,
+			wantState:    circuitOpen,
+		},
+		{
+			name:      "deadline of the cache itself",
+			fn:        func(context.Context) error { return context.DeadlineExceeded },
+			wantState: circuitOpen,
+		},
+		{
+			name:      "configuration error",
+			fn:        func(context.Context) error { return fmt.Errorf("cross slot: %w", errors.ErrUnsupported) },
+			wantState: circuitClosed,
+		},
+		{
+			name:      "storage error",
+			fn:        func(context.Context) error { return errors.New("connection refused") },
+			wantState: circuitOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := New(
+				WithCache(stubCache{fn: tt.fn}),
+				WithCacheTimeout(tt.cacheTimeout),
+				WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1}),
+				WithGlobalLimitRules([]Rule{{Name: "global", Limit: 10, Window: time.Minute}}),
+			)
+			t.Cleanup(func() { _ = rl.Close() })
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+			defer cancel()
+
+			if err := callUnaryContext(ctx, rl, "/test.Service/Method"); err == nil {
+				t.Fatal("call succeeded, want an error")
+			}
+
+			if state := rl.circuitBreaker.state; state != tt.wantState {
+				t.Fatalf("circuit is %s, want %s", state, tt.wantState)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package ratelimiter
 import (
 	"context"
 	"time"
+
+	"github.com/murouse/rate-limiter/quota"
 )
 
 // Cache defines storage behavior for fixed-window rate limiting.
@@ -22,10 +24,169 @@ import (
 // which is NOT the intended behavior of this interface.
 //
 // Implementations should ensure atomicity (e.g. Redis Lua script).
+// A canceled or expired context must be reported as an error
+// and must not increment the counter.
+//
+// Errors wrapping errors.ErrUnsupported report a configuration the
+// cache cannot serve, such as an operation it does not support.
+// They bypass the failure policy and the circuit breaker.
+//
+// The cachetest package verifies these requirements.
 type Cache interface {
 	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
 }
 
+// TTLCache is an optional extension of Cache that reports
+// the remaining TTL of the window alongside the counter.
+//
+// IncrementWithTTL MUST follow the same fixed-window semantics
+// as Cache.Increment and additionally return the time left
+// until the key expires.
+//
+// When the configured cache implements TTLCache, rejections carry
+// the exact time until the window resets.
+type TTLCache interface {
+	IncrementWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error)
+}
+
+// CostCache is an optional extension of Cache that increments
+// fixed-window counters by an arbitrary cost.
+//
+// IncrementBy MUST follow the same fixed-window semantics
+// as Cache.Increment, adding cost instead of one, and return
+// the time left until the key expires like TTLCache.
+//
+// Requests of methods with a cost other than one can only be counted
+// by fixed-window rules when the configured cache implements CostCache.
+type CostCache interface {
+	IncrementBy(ctx context.Context, key string, cost int64, ttl time.Duration) (int64, time.Duration, error)
+}
+
+// QuotaCache is an optional extension of Cache that takes quota
+// from fixed-window counters knowing their limit.
+//
+// Reserve takes counter.Amount() units from the counter if they fit
+// within counter.Limit and returns the resulting state of the limit.
+// A rejected request MUST NOT take any units. The TTL follows the
+// fixed-window semantics of Cache: it is set when the window starts
+// and never extended. Remaining may be an estimate.
+//
+// When the configured cache implements QuotaCache, fixed-window rules
+// evaluated one by one are checked with Reserve instead of IncrementBy.
+type QuotaCache interface {
+	Reserve(ctx context.Context, counter quota.Counter) (quota.Result, error)
+}
+
+// BatchCache is an optional extension of Cache that increments
+// several fixed-window counters in a single storage round trip.
+//
+// IncrementMulti MUST apply the semantics of Cache.Increment to every
+// counter independently and return one result per counter, in order.
+// Each counter is incremented by its cost. A counter is allowed if its
+// value after the increment does not exceed its limit.
+//
+// When the configured cache implements BatchCache, all fixed-window
+// rules of a request are evaluated with a single IncrementMulti call.
+type BatchCache interface {
+	IncrementMulti(ctx context.Context, counters []quota.Counter) ([]quota.Result, error)
+}
+
+// AtomicCache is an optional extension of Cache that applies
+// fixed-window increments to several counters as a single unit.
+//
+// IncrementAll atomically checks whether every counter would stay
+// within its limit after being incremented by its cost and, only if
+// all of them would, increments all counters. Otherwise no counter
+// is modified.
+//
+// Implementations MUST keep the fixed-window TTL semantics of Cache
+// and return one result per counter, in order. A counter is reported
+// as allowed if it alone would stay within its limit, so the caller
+// can tell which counters caused the rejection.
+type AtomicCache interface {
+	IncrementAll(ctx context.Context, counters []quota.Counter) ([]quota.Result, error)
+}
+
+// TokenBucketCache defines storage behavior for token-bucket rate limiting.
+//
+// TakeToken atomically refills the bucket stored under the given key
+// and takes cost tokens from it if that many are available.
+//
+// Implementations MUST ensure that:
+//
+//  1. A missing bucket is treated as full (capacity tokens).
+//  2. The bucket is refilled by one token per refillInterval elapsed
+//     since the last take, and never holds more than capacity tokens.
+//  3. Refill and take happen atomically, so concurrent callers
+//     never take the same token twice.
+//
+// TakeToken reports whether a token was taken, the number of whole
+// tokens left, the time until enough tokens are available (if they
+// were not taken) and the time until the bucket is full again.
+type TokenBucketCache interface {
+	TakeToken(ctx context.Context, key string, cost, capacity int64, refillInterval time.Duration) (quota.Result, error)
+}
+
+// SlidingWindowCache defines storage behavior for sliding-window-counter
+// rate limiting.
+//
+// IncrementSliding atomically increments the counter of the current window
+// for the given key by cost and returns the weighted request count:
+//
+//	current + floor(previous * (window - elapsed) / window)
+//
+// where windows are aligned to multiples of the window duration,
+// current and previous are the counts of the current and the preceding
+// window, and elapsed is the time passed since the current window started.
+//
+// Implementations MUST keep only the current and previous window
+// counts per key and perform the increment and read atomically.
+//
+// IncrementSliding also returns the time until the current window ends.
+type SlidingWindowCache interface {
+	IncrementSliding(ctx context.Context, key string, cost int64, window time.Duration) (int64, time.Duration, error)
+}
+
+// GCRACache defines storage behavior for the generic cell rate algorithm.
+//
+// AllowGCRA atomically evaluates a request against the theoretical
+// arrival time (TAT) stored under the given key. Requests are spaced
+// by emissionInterval and at most burst requests may arrive at once.
+// A request with a cost of n counts as n requests arriving together.
+//
+// Implementations MUST ensure that:
+//
+//  1. A missing TAT is treated as the current time.
+//  2. The TAT is advanced by cost*emissionInterval only when the request
+//     is allowed; rejected requests do not modify the stored value.
+//  3. The read-check-write sequence is atomic.
+//
+// AllowGCRA reports whether the request is allowed, the number of
+// requests that may still arrive at once, the exact time after which
+// a rejected request would be allowed and the time until the TAT
+// is reached (the full burst is available again).
+type GCRACache interface {
+	AllowGCRA(ctx context.Context, key string, cost int64, emissionInterval time.Duration, burst int64) (quota.Result, error)
+}
+
+// SlidingLogCache defines storage behavior for sliding-log rate limiting.
+//
+// AppendLog atomically removes log entries older than window for the
+// given key and, if at least cost free slots remain below limit,
+// records cost new entries with the current time.
+//
+// Implementations MUST ensure that:
+//
+//  1. Rejected requests are not recorded.
+//  2. Eviction, counting and recording happen atomically.
+//
+// AppendLog reports whether the request is allowed, the number of free
+// log slots, the time until enough entries leave the window (for
+// rejected requests) and the time until the newest entry leaves it.
+type SlidingLogCache interface {
+	AppendLog(ctx context.Context, key string, cost, limit int64, window time.Duration) (quota.Result, error)
+}
+
 type Logger interface {
 	Debugf(msg string, args ...any)
 	Infof(msg string, args ...any)
@@ -0,0 +1,120 @@
+package ratelimiter
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	ratelimiterpb "github.com/murouse/rate-limiter/github.com/murouse/rate-limiter"
+)
+
+// maxRequestCost caps the cost of a single request, so that counters
+// summing the costs of many requests cannot overflow.
+const maxRequestCost = math.MaxInt32
+
+// requestCost returns the number of units a request to the given method
+// is counted as by every rule it is checked against.
+//
+// The cost is the method `cost` option (one when not set) multiplied
+// by the value of the request fields annotated with `cost_field`,
+// if any. The cost is never below one nor above maxRequestCost.
+func (rl *RateLimiter) requestCost(fullMethod string, msg proto.Message) int64 {
+	cost := int64(1)
+	if methodCost, ok := rl.getMethodCosts()[fullMethod]; ok {
+		cost = methodCost
+	}
+
+	if fieldCost, ok := extractCostField(msg); ok {
+		cost = saturatingMul(cost, fieldCost)
+	}
+
+	return min(max(1, cost), maxRequestCost)
+}
+
+// extractCostField returns the cost carried by a protobuf message.
+//
+// It sums the top-level fields annotated with the `cost_field` option:
+// the length of repeated and map fields and the value of integer fields.
+// Negative values count as zero, and the sum saturates at math.MaxInt64.
+// Reports false if the message has no annotated fields.
+func extractCostField(msg proto.Message) (int64, bool) {
+	if msg == nil {
+		return 0, false
+	}
+
+	ref := msg.ProtoReflect()
+	fields := ref.Descriptor().Fields()
+
+	var (
+		cost  int64
+		found bool
+	)
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		opts, ok := field.Options().(*descriptorpb.FieldOptions)
+		if !ok || opts == nil || !proto.GetExtension(opts, ratelimiterpb.E_CostField).(bool) {
+			continue
+		}
+		found = true
+
+		val := ref.Get(field)
+		switch {
+		case field.IsList():
+			cost = saturatingAdd(cost, int64(val.List().Len()))
+		case field.IsMap():
+			cost = saturatingAdd(cost, int64(val.Map().Len()))
+		default:
+			// Отрицательное значение не должно уменьшать стоимость других полей
+			cost = saturatingAdd(cost, max(0, protoIntValue(field.Kind(), val)))
+		}
+	}
+
+	return cost, found
+}
+
+// saturatingAdd returns a+b for non-negative a and b,
+// or math.MaxInt64 if the sum overflows.
+func saturatingAdd(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+
+	return a + b
+}
+
+// saturatingMul returns a*b for non-negative a and b,
+// or math.MaxInt64 if the product overflows.
+func saturatingMul(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+
+	return a * b
+}
+
+// protoIntValue returns the value of an integer field.
+// Values of other kinds are reported as zero.
+func protoIntValue(kind protoreflect.Kind, val protoreflect.Value) int64 {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return val.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// Значения больше MaxInt64 не имеют смысла как стоимость
+		return int64(min(val.Uint(), uint64(1<<63-1)))
+	default:
+		return 0
+	}
+}
+
+// getMethodCosts returns the cached map of gRPC method names
+// to the constant cost set with the `cost` option.
+//
+// Costs are loaded together with the method rules.
+func (rl *RateLimiter) getMethodCosts() map[string]int64 {
+	rl.methodRulesOnce.Do(rl.loadMethodRules)
+	return rl.methodCosts
+}
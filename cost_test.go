@@ -0,0 +1,130 @@
+package ratelimiter
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	ratelimiterpb "github.com/murouse/rate-limiter/github.com/murouse/rate-limiter"
+)
+
+// costRequestDescriptor describes a request message with the cost
+// carried by its `ids`, `count` and `units` fields.
+var costRequestDescriptor = func() protoreflect.MessageDescriptor {
+	costField := &descriptorpb.FieldOptions{}
+	proto.SetExtension(costField, ratelimiterpb.E_CostField, true)
+
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+			JsonName: proto.String(name),
+			Options:  costField,
+		}
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("cost_test.proto"),
+		Package: proto.String("ratelimiter.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("CostRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("ids", 1, descriptorpb.FieldDescriptorProto_LABEL_REPEATED, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("count", 2, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+				field("units", 3, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_TYPE_UINT64),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return file.Messages().Get(0)
+}()
+
+// costRequest builds a request carrying the given cost fields.
+func costRequest(ids int, count int64, units uint64) proto.Message {
+	msg := dynamicpb.NewMessage(costRequestDescriptor)
+	fields := costRequestDescriptor.Fields()
+
+	list := msg.Mutable(fields.ByName("ids")).List()
+	for range ids {
+		list.Append(protoreflect.ValueOfString("id"))
+	}
+	msg.Set(fields.ByName("count"), protoreflect.ValueOfInt64(count))
+	msg.Set(fields.ByName("units"), protoreflect.ValueOfUint64(units))
+
+	return msg
+}
+
+func TestExtractCostField(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       proto.Message
+		want      int64
+		wantFound bool
+	}{
+		{name: "nil message", msg: nil, want: 0, wantFound: false},
+		{name: "no annotated fields", msg: &descriptorpb.FieldOptions{}, want: 0, wantFound: false},
+		{name: "empty", msg: costRequest(0, 0, 0), want: 0, wantFound: true},
+		{name: "sum", msg: costRequest(3, 4, 5), want: 12, wantFound: true},
+		{name: "negative value", msg: costRequest(3, -100, 0), want: 3, wantFound: true},
+		{name: "huge unsigned value", msg: costRequest(0, 0, math.MaxUint64), want: math.MaxInt64, wantFound: true},
+		{name: "overflowing sum", msg: costRequest(2, math.MaxInt64, math.MaxUint64), want: math.MaxInt64, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := extractCostField(tt.msg)
+			if got != tt.want || found != tt.wantFound {
+				t.Fatalf("extractCostField() = %d, %t, want %d, %t", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestRequestCost(t *testing.T) {
+	const (
+		method  = "/test.Service/Method"
+		doubled = "/test.Service/Doubled"
+	)
+
+	rl := New()
+	t.Cleanup(func() { _ = rl.Close() })
+
+	// Стоимости методов задаются напрямую, минуя загрузку правил из реестра
+	rl.methodRulesOnce.Do(func() {})
+	rl.methodCosts = map[string]int64{doubled: 2}
+
+	tests := []struct {
+		name   string
+		method string
+		msg    proto.Message
+		want   int64
+	}{
+		{name: "default", method: method, msg: nil, want: 1},
+		{name: "method cost", method: doubled, msg: nil, want: 2},
+		{name: "field cost", method: method, msg: costRequest(3, 0, 0), want: 3},
+		{name: "method times field cost", method: doubled, msg: costRequest(3, 0, 0), want: 6},
+		{name: "empty request", method: doubled, msg: costRequest(0, 0, 0), want: 1},
+		{name: "negative value", method: doubled, msg: costRequest(0, -5, 0), want: 1},
+		{name: "capped", method: method, msg: costRequest(0, math.MaxInt64, 0), want: maxRequestCost},
+		{name: "overflowing product", method: doubled, msg: costRequest(0, math.MaxInt64, 0), want: maxRequestCost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rl.requestCost(tt.method, tt.msg); got != tt.want {
+				t.Fatalf("requestCost() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
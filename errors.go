@@ -0,0 +1,31 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAlgorithmNotSupported is returned when a rule uses an algorithm
+// that the configured cache does not implement.
+var ErrAlgorithmNotSupported = errors.New("algorithm is not supported by cache")
+
+// ErrCostNotSupported is returned when a fixed-window rule counts
+// a request costing more than one unit but the configured cache
+// does not implement CostCache.
+var ErrCostNotSupported = errors.New("request cost is not supported by cache")
+
+// ErrInvalidWindow is returned when a rule using an algorithm other than
+// fixed window has a window that is not positive or too short to spread
+// its limit over. It wraps errors.ErrUnsupported: like the errors above
+// it is a configuration error, so it bypasses failure policies and is
+// not counted by the circuit breaker.
+var ErrInvalidWindow = fmt.Errorf("rule window is invalid for its algorithm: %w", errors.ErrUnsupported)
+
+// ErrAllOrNothingNotSupported is returned when all-or-nothing mode
+// is enabled but the configured cache does not implement AtomicCache
+// or a rule uses an algorithm other than fixed window.
+var ErrAllOrNothingNotSupported = errors.New("all-or-nothing mode is not supported by cache")
+
+// ErrCircuitOpen is returned instead of calling the cache
+// while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/murouse/rate-limiter/cache/memory"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// failurePolicyOf returns the failure policy effective for the given rule.
+//
+// Rules without their own policy inherit the limiter's policy,
+// which defaults to FailurePolicyFailClosed.
+func (rl *RateLimiter) failurePolicyOf(rule Rule) FailurePolicy {
+	if rule.FailurePolicy != FailurePolicyUnspecified {
+		return rule.FailurePolicy
+	}
+	if rl.failurePolicy != FailurePolicyUnspecified {
+		return rl.failurePolicy
+	}
+
+	return FailurePolicyFailClosed
+}
+
+// handleFailure applies the failure policy of the rule to a failed cache call.
+//
+// Configuration errors are not storage failures and are always returned as is.
+func (rl *RateLimiter) handleFailure(ctx context.Context, fullRateKey string, rule Rule, cost int64, err error) (quota.Result, error) {
+	if isConfigError(err) {
+		return quota.Result{}, err
+	}
+
+	switch rl.failurePolicyOf(rule) {
+	case FailurePolicyFailOpen:
+		rl.logger.Warnf("failing open for rule %q, key %q: %v", rule.Name, fullRateKey, err)
+		return quota.Result{Allowed: true, Remaining: int64(rule.Limit), ResetAfter: rule.Window}, nil
+	case FailurePolicyLocalFallback:
+		rl.logger.Warnf("falling back to local cache for rule %q, key %q: %v", rule.Name, fullRateKey, err)
+
+		// Запрос к кэшу мог упасть по таймауту, поэтому локальная проверка не наследует его дедлайн
+		return rl.checkRule(context.WithoutCancel(ctx), rl.getFallbackCache(), fullRateKey, rl.scaleRule(rule), cost)
+	default:
+		return quota.Result{}, err
+	}
+}
+
+// isConfigError reports whether a cache call error is caused by
+// the limiter or cache configuration rather than by the storage:
+// ErrAlgorithmNotSupported, ErrCostNotSupported or any error
+// wrapping errors.ErrUnsupported.
+func isConfigError(err error) bool {
+	return errors.Is(err, ErrAlgorithmNotSupported) ||
+		errors.Is(err, ErrCostNotSupported) ||
+		errors.Is(err, errors.ErrUnsupported)
+}
+
+// scaleRule returns the rule with its limit and burst scaled
+// for evaluation against the local fallback cache.
+//
+// Positive values are never scaled below one request.
+func (rl *RateLimiter) scaleRule(rule Rule) Rule {
+	scale := func(n int) int {
+		if n <= 0 {
+			return n
+		}
+
+		return max(1, int(math.Floor(float64(n)*rl.localFallbackScale)))
+	}
+
+	rule.Limit = scale(rule.Limit)
+	rule.Burst = scale(rule.Burst)
+
+	return rule
+}
+
+// getFallbackCache returns the local cache used by FailurePolicyLocalFallback.
+//
+// The cache is created on first use and closed by Close.
+func (rl *RateLimiter) getFallbackCache() *memory.Cache {
+	rl.fallbackCacheOnce.Do(func() {
+		rl.fallbackCache = memory.New()
+	})
+
+	return rl.fallbackCache
+}
+
+// cacheContext returns the context used for cache calls of one request.
+//
+// When a cache timeout is configured, the context is detached from
+// the request cancellation and bounded by the timeout instead.
+func (rl *RateLimiter) cacheContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if rl.cacheTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(context.WithoutCancel(ctx), rl.cacheTimeout)
+}
@@ -0,0 +1,175 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// failingBucketCache fails token bucket calls as well as increments.
+type failingBucketCache struct {
+	stubCache
+}
+
+func (c failingBucketCache) TakeToken(ctx context.Context, _ string, _, _ int64, _ time.Duration) (quota.Result, error) {
+	return quota.Result{}, c.fn(ctx)
+}
+
+// TestFailurePolicies checks how each failure policy
+// enforces rules while every cache call fails.
+func TestFailurePolicies(t *testing.T) {
+	failing := stubCache{fn: func(context.Context) error { return errors.New("connection refused") }}
+	failingBucket := failingBucketCache{failing}
+	unsupported := stubCache{fn: func(context.Context) error { return fmt.Errorf("cross slot: %w", errors.ErrUnsupported) }}
+
+	fixed := Rule{Name: "fixed", Limit: 4, Window: time.Minute}
+	bucket := Rule{Name: "bucket", Limit: 10, Window: time.Minute, Algorithm: AlgorithmTokenBucket, Burst: 4}
+
+	withPolicy := func(rule Rule, policy FailurePolicy) Rule {
+		rule.FailurePolicy = policy
+		return rule
+	}
+
+	tests := []struct {
+		name  string
+		cache Cache
+		opts  []Option
+		rule  Rule
+		want  []codes.Code
+	}{
+		{
+			name:  "fail closed by default",
+			cache: failing,
+			rule:  fixed,
+			want:  []codes.Code{codes.Internal, codes.Internal},
+		},
+		{
+			name:  "fail closed",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyFailClosed)},
+			rule:  fixed,
+			want:  []codes.Code{codes.Internal, codes.Internal},
+		},
+		{
+			name:  "fail open",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyFailOpen)},
+			rule:  fixed,
+			want:  []codes.Code{codes.OK, codes.OK, codes.OK, codes.OK, codes.OK, codes.OK},
+		},
+		{
+			name:  "rule policy overrides limiter policy",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyFailOpen)},
+			rule:  withPolicy(fixed, FailurePolicyFailClosed),
+			want:  []codes.Code{codes.Internal},
+		},
+		{
+			name:  "local fallback",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyLocalFallback)},
+			rule:  fixed,
+			want:  []codes.Code{codes.OK, codes.OK, codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:  "local fallback scales limit",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyLocalFallback), WithLocalFallbackScale(0.5)},
+			rule:  fixed,
+			want:  []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:  "local fallback scales burst",
+			cache: failingBucket,
+			opts:  []Option{WithLocalFallbackScale(0.5)},
+			rule:  withPolicy(bucket, FailurePolicyLocalFallback),
+			want:  []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:  "unsupported operation bypasses fail open",
+			cache: unsupported,
+			opts:  []Option{WithFailurePolicy(FailurePolicyFailOpen)},
+			rule:  fixed,
+			want:  []codes.Code{codes.Internal},
+		},
+		{
+			name:  "unsupported algorithm bypasses local fallback",
+			cache: failing,
+			opts:  []Option{WithFailurePolicy(FailurePolicyLocalFallback)},
+			rule:  bucket,
+			want:  []codes.Code{codes.Internal},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithCache(tt.cache), WithGlobalLimitRules([]Rule{tt.rule})}, tt.opts...)
+			rl := New(opts...)
+			t.Cleanup(func() { _ = rl.Close() })
+
+			for i, want := range tt.want {
+				if err := callUnary(rl, "/test.Service/Method"); status.Code(err) != want {
+					t.Fatalf("call #%d: got %v, want %s", i+1, err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestLocalFallbackAfterCacheTimeout checks that the local fallback
+// is evaluated even though the cache call exhausted the cache timeout.
+func TestLocalFallbackAfterCacheTimeout(t *testing.T) {
+	cache := stubCache{fn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	rl := New(
+		WithCache(cache),
+		WithCacheTimeout(time.Millisecond),
+		WithFailurePolicy(FailurePolicyLocalFallback),
+		WithGlobalLimitRules([]Rule{{Name: "fixed", Limit: 1, Window: time.Minute}}),
+	)
+	t.Cleanup(func() { _ = rl.Close() })
+
+	if err := callUnary(rl, "/test.Service/Method"); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if err := callUnary(rl, "/test.Service/Method"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second call: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestScaleRule(t *testing.T) {
+	rl := New(WithLocalFallbackScale(0.25))
+	t.Cleanup(func() { _ = rl.Close() })
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		wantLimit int
+		wantBurst int
+	}{
+		{name: "scaled", rule: Rule{Limit: 10, Burst: 8}, wantLimit: 2, wantBurst: 2},
+		{name: "never below one", rule: Rule{Limit: 3, Burst: 1}, wantLimit: 1, wantBurst: 1},
+		{name: "default burst kept", rule: Rule{Limit: 100}, wantLimit: 25, wantBurst: 0},
+		{name: "zero limit kept", rule: Rule{Limit: 0}, wantLimit: 0, wantBurst: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rl.scaleRule(tt.rule)
+			if got.Limit != tt.wantLimit || got.Burst != tt.wantBurst {
+				t.Fatalf("scaleRule() = limit %d, burst %d, want limit %d, burst %d",
+					got.Limit, got.Burst, tt.wantLimit, tt.wantBurst)
+			}
+		})
+	}
+}
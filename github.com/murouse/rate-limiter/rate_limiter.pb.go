@@ -23,18 +23,182 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Algorithm int32
+
+const (
+	Algorithm_ALGORITHM_FIXED_WINDOW   Algorithm = 0
+	Algorithm_ALGORITHM_TOKEN_BUCKET   Algorithm = 1
+	Algorithm_ALGORITHM_SLIDING_WINDOW Algorithm = 2
+	Algorithm_ALGORITHM_GCRA           Algorithm = 3
+	Algorithm_ALGORITHM_SLIDING_LOG    Algorithm = 4
+)
+
+// Enum value maps for Algorithm.
+var (
+	Algorithm_name = map[int32]string{
+		0: "ALGORITHM_FIXED_WINDOW",
+		1: "ALGORITHM_TOKEN_BUCKET",
+		2: "ALGORITHM_SLIDING_WINDOW",
+		3: "ALGORITHM_GCRA",
+		4: "ALGORITHM_SLIDING_LOG",
+	}
+	Algorithm_value = map[string]int32{
+		"ALGORITHM_FIXED_WINDOW":   0,
+		"ALGORITHM_TOKEN_BUCKET":   1,
+		"ALGORITHM_SLIDING_WINDOW": 2,
+		"ALGORITHM_GCRA":           3,
+		"ALGORITHM_SLIDING_LOG":    4,
+	}
+)
+
+func (x Algorithm) Enum() *Algorithm {
+	p := new(Algorithm)
+	*p = x
+	return p
+}
+
+func (x Algorithm) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Algorithm) Descriptor() protoreflect.EnumDescriptor {
+	return file_rate_limiter_proto_enumTypes[0].Descriptor()
+}
+
+func (Algorithm) Type() protoreflect.EnumType {
+	return &file_rate_limiter_proto_enumTypes[0]
+}
+
+func (x Algorithm) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Algorithm.Descriptor instead.
+func (Algorithm) EnumDescriptor() ([]byte, []int) {
+	return file_rate_limiter_proto_rawDescGZIP(), []int{0}
+}
+
+type FailurePolicy int32
+
+const (
+	FailurePolicy_FAILURE_POLICY_UNSPECIFIED    FailurePolicy = 0
+	FailurePolicy_FAILURE_POLICY_FAIL_CLOSED    FailurePolicy = 1
+	FailurePolicy_FAILURE_POLICY_FAIL_OPEN      FailurePolicy = 2
+	FailurePolicy_FAILURE_POLICY_LOCAL_FALLBACK FailurePolicy = 3
+)
+
+// Enum value maps for FailurePolicy.
+var (
+	FailurePolicy_name = map[int32]string{
+		0: "FAILURE_POLICY_UNSPECIFIED",
+		1: "FAILURE_POLICY_FAIL_CLOSED",
+		2: "FAILURE_POLICY_FAIL_OPEN",
+		3: "FAILURE_POLICY_LOCAL_FALLBACK",
+	}
+	FailurePolicy_value = map[string]int32{
+		"FAILURE_POLICY_UNSPECIFIED":    0,
+		"FAILURE_POLICY_FAIL_CLOSED":    1,
+		"FAILURE_POLICY_FAIL_OPEN":      2,
+		"FAILURE_POLICY_LOCAL_FALLBACK": 3,
+	}
+)
+
+func (x FailurePolicy) Enum() *FailurePolicy {
+	p := new(FailurePolicy)
+	*p = x
+	return p
+}
+
+func (x FailurePolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FailurePolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_rate_limiter_proto_enumTypes[1].Descriptor()
+}
+
+func (FailurePolicy) Type() protoreflect.EnumType {
+	return &file_rate_limiter_proto_enumTypes[1]
+}
+
+func (x FailurePolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FailurePolicy.Descriptor instead.
+func (FailurePolicy) EnumDescriptor() ([]byte, []int) {
+	return file_rate_limiter_proto_rawDescGZIP(), []int{1}
+}
+
+type RuleKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RateKeys      []string               `protobuf:"bytes,1,rep,name=rate_keys,json=rateKeys,proto3" json:"rate_keys,omitempty"`
+	Extension     bool                   `protobuf:"varint,2,opt,name=extension,proto3" json:"extension,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RuleKey) Reset() {
+	*x = RuleKey{}
+	mi := &file_rate_limiter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RuleKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RuleKey) ProtoMessage() {}
+
+func (x *RuleKey) ProtoReflect() protoreflect.Message {
+	mi := &file_rate_limiter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RuleKey.ProtoReflect.Descriptor instead.
+func (*RuleKey) Descriptor() ([]byte, []int) {
+	return file_rate_limiter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RuleKey) GetRateKeys() []string {
+	if x != nil {
+		return x.RateKeys
+	}
+	return nil
+}
+
+func (x *RuleKey) GetExtension() bool {
+	if x != nil {
+		return x.Extension
+	}
+	return false
+}
+
 type Rule struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
 	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
 	Window        *durationpb.Duration   `protobuf:"bytes,3,opt,name=window,proto3" json:"window,omitempty"`
+	Algorithm     Algorithm              `protobuf:"varint,4,opt,name=algorithm,proto3,enum=rate_limiter.Algorithm" json:"algorithm,omitempty"`
+	Burst         int32                  `protobuf:"varint,5,opt,name=burst,proto3" json:"burst,omitempty"`
+	FailurePolicy FailurePolicy          `protobuf:"varint,6,opt,name=failure_policy,json=failurePolicy,proto3,enum=rate_limiter.FailurePolicy" json:"failure_policy,omitempty"`
+	Key           *RuleKey               `protobuf:"bytes,7,opt,name=key,proto3" json:"key,omitempty"`
+	Scope         string                 `protobuf:"bytes,8,opt,name=scope,proto3" json:"scope,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Rule) Reset() {
 	*x = Rule{}
-	mi := &file_rate_limiter_proto_msgTypes[0]
+	mi := &file_rate_limiter_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -46,7 +210,7 @@ func (x *Rule) String() string {
 func (*Rule) ProtoMessage() {}
 
 func (x *Rule) ProtoReflect() protoreflect.Message {
-	mi := &file_rate_limiter_proto_msgTypes[0]
+	mi := &file_rate_limiter_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -59,7 +223,7 @@ func (x *Rule) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Rule.ProtoReflect.Descriptor instead.
 func (*Rule) Descriptor() ([]byte, []int) {
-	return file_rate_limiter_proto_rawDescGZIP(), []int{0}
+	return file_rate_limiter_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *Rule) GetName() string {
@@ -83,6 +247,41 @@ func (x *Rule) GetWindow() *durationpb.Duration {
 	return nil
 }
 
+func (x *Rule) GetAlgorithm() Algorithm {
+	if x != nil {
+		return x.Algorithm
+	}
+	return Algorithm_ALGORITHM_FIXED_WINDOW
+}
+
+func (x *Rule) GetBurst() int32 {
+	if x != nil {
+		return x.Burst
+	}
+	return 0
+}
+
+func (x *Rule) GetFailurePolicy() FailurePolicy {
+	if x != nil {
+		return x.FailurePolicy
+	}
+	return FailurePolicy_FAILURE_POLICY_UNSPECIFIED
+}
+
+func (x *Rule) GetKey() *RuleKey {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *Rule) GetScope() string {
+	if x != nil {
+		return x.Scope
+	}
+	return ""
+}
+
 var file_rate_limiter_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
 		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
@@ -92,6 +291,38 @@ var file_rate_limiter_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "bytes,51234,rep,name=rules",
 		Filename:      "rate_limiter.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         51238,
+		Name:          "rate_limiter.skip_inherited_rules",
+		Tag:           "varint,51238,opt,name=skip_inherited_rules",
+		Filename:      "rate_limiter.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*int32)(nil),
+		Field:         51239,
+		Name:          "rate_limiter.cost",
+		Tag:           "varint,51239,opt,name=cost",
+		Filename:      "rate_limiter.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.ServiceOptions)(nil),
+		ExtensionType: ([]*Rule)(nil),
+		Field:         51236,
+		Name:          "rate_limiter.service_rules",
+		Tag:           "bytes,51236,rep,name=service_rules",
+		Filename:      "rate_limiter.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FileOptions)(nil),
+		ExtensionType: ([]*Rule)(nil),
+		Field:         51237,
+		Name:          "rate_limiter.file_rules",
+		Tag:           "bytes,51237,rep,name=file_rules",
+		Filename:      "rate_limiter.proto",
+	},
 	{
 		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
 		ExtensionType: (*string)(nil),
@@ -100,31 +331,83 @@ var file_rate_limiter_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "bytes,51235,opt,name=rate_key",
 		Filename:      "rate_limiter.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         51240,
+		Name:          "rate_limiter.cost_field",
+		Tag:           "varint,51240,opt,name=cost_field",
+		Filename:      "rate_limiter.proto",
+	},
 }
 
 // Extension fields to descriptorpb.MethodOptions.
 var (
 	// repeated rate_limiter.Rule rules = 51234;
 	E_Rules = &file_rate_limiter_proto_extTypes[0]
+	// optional bool skip_inherited_rules = 51238;
+	E_SkipInheritedRules = &file_rate_limiter_proto_extTypes[1]
+	// optional int32 cost = 51239;
+	E_Cost = &file_rate_limiter_proto_extTypes[2]
+)
+
+// Extension fields to descriptorpb.ServiceOptions.
+var (
+	// repeated rate_limiter.Rule service_rules = 51236;
+	E_ServiceRules = &file_rate_limiter_proto_extTypes[3]
+)
+
+// Extension fields to descriptorpb.FileOptions.
+var (
+	// repeated rate_limiter.Rule file_rules = 51237;
+	E_FileRules = &file_rate_limiter_proto_extTypes[4]
 )
 
 // Extension fields to descriptorpb.FieldOptions.
 var (
 	// optional string rate_key = 51235;
-	E_RateKey = &file_rate_limiter_proto_extTypes[1]
+	E_RateKey = &file_rate_limiter_proto_extTypes[5]
+	// optional bool cost_field = 51240;
+	E_CostField = &file_rate_limiter_proto_extTypes[6]
 )
 
 var File_rate_limiter_proto protoreflect.FileDescriptor
 
 const file_rate_limiter_proto_rawDesc = "" +
 	"\n" +
-	"\x12rate_limiter.proto\x12\frate_limiter\x1a google/protobuf/descriptor.proto\x1a\x1egoogle/protobuf/duration.proto\"c\n" +
+	"\x12rate_limiter.proto\x12\frate_limiter\x1a google/protobuf/descriptor.proto\x1a\x1egoogle/protobuf/duration.proto\"D\n" +
+	"\aRuleKey\x12\x1b\n" +
+	"\trate_keys\x18\x01 \x03(\tR\brateKeys\x12\x1c\n" +
+	"\textension\x18\x02 \x01(\bR\textension\"\xb3\x02\n" +
 	"\x04Rule\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
 	"\x05limit\x18\x02 \x01(\x05R\x05limit\x121\n" +
-	"\x06window\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x06window:J\n" +
-	"\x05rules\x12\x1e.google.protobuf.MethodOptions\x18\xa2\x90\x03 \x03(\v2\x12.rate_limiter.RuleR\x05rules::\n" +
-	"\brate_key\x12\x1d.google.protobuf.FieldOptions\x18\xa3\x90\x03 \x01(\tR\arateKeyB.Z,github.com/murouse/rate-limiter;rate_limiterb\x06proto3"
+	"\x06window\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x06window\x125\n" +
+	"\talgorithm\x18\x04 \x01(\x0e2\x17.rate_limiter.AlgorithmR\talgorithm\x12\x14\n" +
+	"\x05burst\x18\x05 \x01(\x05R\x05burst\x12B\n" +
+	"\x0efailure_policy\x18\x06 \x01(\x0e2\x1b.rate_limiter.FailurePolicyR\rfailurePolicy\x12'\n" +
+	"\x03key\x18\a \x01(\v2\x15.rate_limiter.RuleKeyR\x03key\x12\x14\n" +
+	"\x05scope\x18\b \x01(\tR\x05scope*\x90\x01\n" +
+	"\tAlgorithm\x12\x1a\n" +
+	"\x16ALGORITHM_FIXED_WINDOW\x10\x00\x12\x1a\n" +
+	"\x16ALGORITHM_TOKEN_BUCKET\x10\x01\x12\x1c\n" +
+	"\x18ALGORITHM_SLIDING_WINDOW\x10\x02\x12\x12\n" +
+	"\x0eALGORITHM_GCRA\x10\x03\x12\x19\n" +
+	"\x15ALGORITHM_SLIDING_LOG\x10\x04*\x90\x01\n" +
+	"\rFailurePolicy\x12\x1e\n" +
+	"\x1aFAILURE_POLICY_UNSPECIFIED\x10\x00\x12\x1e\n" +
+	"\x1aFAILURE_POLICY_FAIL_CLOSED\x10\x01\x12\x1c\n" +
+	"\x18FAILURE_POLICY_FAIL_OPEN\x10\x02\x12!\n" +
+	"\x1dFAILURE_POLICY_LOCAL_FALLBACK\x10\x03:J\n" +
+	"\x05rules\x12\x1e.google.protobuf.MethodOptions\x18\xa2\x90\x03 \x03(\v2\x12.rate_limiter.RuleR\x05rules:R\n" +
+	"\x14skip_inherited_rules\x12\x1e.google.protobuf.MethodOptions\x18\xa6\x90\x03 \x01(\bR\x12skipInheritedRules:4\n" +
+	"\x04cost\x12\x1e.google.protobuf.MethodOptions\x18\xa7\x90\x03 \x01(\x05R\x04cost:Z\n" +
+	"\rservice_rules\x12\x1f.google.protobuf.ServiceOptions\x18\xa4\x90\x03 \x03(\v2\x12.rate_limiter.RuleR\fserviceRules:Q\n" +
+	"\n" +
+	"file_rules\x12\x1c.google.protobuf.FileOptions\x18\xa5\x90\x03 \x03(\v2\x12.rate_limiter.RuleR\tfileRules::\n" +
+	"\brate_key\x12\x1d.google.protobuf.FieldOptions\x18\xa3\x90\x03 \x01(\tR\arateKey:>\n" +
+	"\n" +
+	"cost_field\x12\x1d.google.protobuf.FieldOptions\x18\xa8\x90\x03 \x01(\bR\tcostFieldB.Z,github.com/murouse/rate-limiter;rate_limiterb\x06proto3"
 
 var (
 	file_rate_limiter_proto_rawDescOnce sync.Once
@@ -138,23 +421,39 @@ func file_rate_limiter_proto_rawDescGZIP() []byte {
 	return file_rate_limiter_proto_rawDescData
 }
 
-var file_rate_limiter_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_rate_limiter_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_rate_limiter_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_rate_limiter_proto_goTypes = []any{
-	(*Rule)(nil),                       // 0: rate_limiter.Rule
-	(*durationpb.Duration)(nil),        // 1: google.protobuf.Duration
-	(*descriptorpb.MethodOptions)(nil), // 2: google.protobuf.MethodOptions
-	(*descriptorpb.FieldOptions)(nil),  // 3: google.protobuf.FieldOptions
+	(Algorithm)(0),                      // 0: rate_limiter.Algorithm
+	(FailurePolicy)(0),                  // 1: rate_limiter.FailurePolicy
+	(*RuleKey)(nil),                     // 2: rate_limiter.RuleKey
+	(*Rule)(nil),                        // 3: rate_limiter.Rule
+	(*durationpb.Duration)(nil),         // 4: google.protobuf.Duration
+	(*descriptorpb.MethodOptions)(nil),  // 5: google.protobuf.MethodOptions
+	(*descriptorpb.ServiceOptions)(nil), // 6: google.protobuf.ServiceOptions
+	(*descriptorpb.FileOptions)(nil),    // 7: google.protobuf.FileOptions
+	(*descriptorpb.FieldOptions)(nil),   // 8: google.protobuf.FieldOptions
 }
 var file_rate_limiter_proto_depIdxs = []int32{
-	1, // 0: rate_limiter.Rule.window:type_name -> google.protobuf.Duration
-	2, // 1: rate_limiter.rules:extendee -> google.protobuf.MethodOptions
-	3, // 2: rate_limiter.rate_key:extendee -> google.protobuf.FieldOptions
-	0, // 3: rate_limiter.rules:type_name -> rate_limiter.Rule
-	4, // [4:4] is the sub-list for method output_type
-	4, // [4:4] is the sub-list for method input_type
-	3, // [3:4] is the sub-list for extension type_name
-	1, // [1:3] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	4,  // 0: rate_limiter.Rule.window:type_name -> google.protobuf.Duration
+	0,  // 1: rate_limiter.Rule.algorithm:type_name -> rate_limiter.Algorithm
+	1,  // 2: rate_limiter.Rule.failure_policy:type_name -> rate_limiter.FailurePolicy
+	2,  // 3: rate_limiter.Rule.key:type_name -> rate_limiter.RuleKey
+	5,  // 4: rate_limiter.rules:extendee -> google.protobuf.MethodOptions
+	5,  // 5: rate_limiter.skip_inherited_rules:extendee -> google.protobuf.MethodOptions
+	5,  // 6: rate_limiter.cost:extendee -> google.protobuf.MethodOptions
+	6,  // 7: rate_limiter.service_rules:extendee -> google.protobuf.ServiceOptions
+	7,  // 8: rate_limiter.file_rules:extendee -> google.protobuf.FileOptions
+	8,  // 9: rate_limiter.rate_key:extendee -> google.protobuf.FieldOptions
+	8,  // 10: rate_limiter.cost_field:extendee -> google.protobuf.FieldOptions
+	3,  // 11: rate_limiter.rules:type_name -> rate_limiter.Rule
+	3,  // 12: rate_limiter.service_rules:type_name -> rate_limiter.Rule
+	3,  // 13: rate_limiter.file_rules:type_name -> rate_limiter.Rule
+	14, // [14:14] is the sub-list for method output_type
+	14, // [14:14] is the sub-list for method input_type
+	11, // [11:14] is the sub-list for extension type_name
+	4,  // [4:11] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_rate_limiter_proto_init() }
@@ -167,13 +466,14 @@ func file_rate_limiter_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rate_limiter_proto_rawDesc), len(file_rate_limiter_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   1,
-			NumExtensions: 2,
+			NumEnums:      2,
+			NumMessages:   2,
+			NumExtensions: 7,
 			NumServices:   0,
 		},
 		GoTypes:           file_rate_limiter_proto_goTypes,
 		DependencyIndexes: file_rate_limiter_proto_depIdxs,
+		EnumInfos:         file_rate_limiter_proto_enumTypes,
 		MessageInfos:      file_rate_limiter_proto_msgTypes,
 		ExtensionInfos:    file_rate_limiter_proto_extTypes,
 	}.Build()
@@ -0,0 +1,67 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/samber/lo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Rate limit metadata keys, following the IETF RateLimit header fields draft
+// (draft-ietf-httpapi-ratelimit-headers).
+const (
+	headerRateLimitLimit     = "ratelimit-limit"
+	headerRateLimitRemaining = "ratelimit-remaining"
+	headerRateLimitReset     = "ratelimit-reset"
+	headerRateLimitPolicy    = "ratelimit-policy"
+)
+
+// setRateLimitHeaders reports the most restrictive rule in response metadata.
+//
+// Allowed requests carry the fields as headers. Rejected requests carry
+// them as trailers, since no response headers are sent for them.
+// Values are:
+//
+//	ratelimit-limit:     <limit>
+//	ratelimit-remaining: <remaining requests>
+//	ratelimit-reset:     <seconds until the quota resets>
+//	ratelimit-policy:    <limit>;w=<window seconds>
+func (rl *RateLimiter) setRateLimitHeaders(ctx context.Context, results []ruleResult, rejected bool) {
+	if len(results) == 0 {
+		return
+	}
+
+	// Самое строгое правило: меньше всего оставшихся запросов, при равенстве — дольше до сброса
+	r := lo.MinBy(results, func(a, b ruleResult) bool {
+		if a.Remaining != b.Remaining {
+			return a.Remaining < b.Remaining
+		}
+
+		return a.ResetAfter > b.ResetAfter
+	})
+
+	md := metadata.Pairs(
+		headerRateLimitLimit, strconv.Itoa(r.rule.Limit),
+		headerRateLimitRemaining, strconv.FormatInt(r.Remaining, 10),
+		headerRateLimitReset, strconv.FormatInt(ceilSeconds(r.ResetAfter), 10),
+		headerRateLimitPolicy, fmt.Sprintf("%d;w=%d", r.rule.Limit, ceilSeconds(r.rule.Window)),
+	)
+
+	set := grpc.SetHeader
+	if rejected {
+		set = grpc.SetTrailer
+	}
+
+	if err := set(ctx, md); err != nil {
+		rl.logger.Warnf("cannot set rate limit metadata: %v", err)
+	}
+}
+
+// ceilSeconds rounds the duration up to whole seconds.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -3,7 +3,9 @@ package ratelimiter
 import (
 	"context"
 	"fmt"
+	"slices"
 
+	"github.com/samber/lo"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -13,6 +15,7 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	ratelimiterpb "github.com/murouse/rate-limiter/github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/quota"
 )
 
 // UnaryServerInterceptor returns a gRPC unary server interceptor
@@ -22,11 +25,16 @@ import (
 // from protobuf messages, and rejects requests that exceed configured limits.
 func (rl *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		// Извлекаем атрибуты
-		var attrs map[string]string
-		if msg, ok := req.(proto.Message); ok {
+		// Извлекаем атрибуты и стоимость запроса
+		var (
+			attrs map[string]string
+			msg   proto.Message
+		)
+		if m, ok := req.(proto.Message); ok {
+			msg = m
 			attrs = extractRateKeyAttrs(msg)
 		}
+		cost := rl.requestCost(info.FullMethod, msg)
 
 		// Извлекаем дополнительный кастомный rate key (например идентификатор пользователя из контекста)
 		rateKeyExtension, err := rl.rateKeyExtender(ctx, req, info)
@@ -37,71 +45,234 @@ func (rl *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 		rl.logger.Debugf("rate key extension %q for method %q", rateKeyExtension, info.FullMethod)
 
 		methodRules := rl.getMethodRules()[info.FullMethod]
-		rl.logger.Debugf("found %d rate limit rules for method %q", len(methodRules), info.FullMethod)
+		rl.logger.Debugf("found %d rate limit rules for method %q, request cost %d", len(methodRules), info.FullMethod, cost)
 
-		exceededRules, err := rl.allow(ctx, rateKeyExtension, info.FullMethod, attrs, methodRules)
-		if err != nil {
-			rl.logger.Errorf("error checking rate limits for key %q, method %q: %v", rateKeyExtension, info.FullMethod, err)
-			return nil, status.Errorf(codes.Internal, "rate limiter allow: %v", err)
+		results, err := rl.enforce(ctx, rateKeyExtension, info.FullMethod, "", attrs, cost, methodRules)
+		if rl.rateLimitHeaders {
+			rl.setRateLimitHeaders(ctx, results, err != nil)
 		}
-		if len(exceededRules) > 0 {
-			return nil, rl.exceedErrorFormatter(exceededRules)
+		if err != nil {
+			return nil, err
 		}
 
 		return handler(ctx, req)
 	}
 }
 
+// ruleResult is the outcome of evaluating a single rule for a request.
+type ruleResult struct {
+	quota.Result
+
+	rule Rule
+	key  string
+	cost int64
+}
+
+// enforce runs allow for the given request and converts its outcome
+// into a gRPC error: Internal on storage failures not absorbed by
+// the failure policy and the configured exceed error when one or more
+// rules are exceeded.
+//
+// The per-rule results are returned alongside the exceed error.
+func (rl *RateLimiter) enforce(ctx context.Context, rateKeyExtension, fullMethod, keySuffix string, attrs map[string]string, cost int64, methodRules []Rule) ([]ruleResult, error) {
+	results, err := rl.allow(ctx, rateKeyExtension, fullMethod, keySuffix, attrs, cost, methodRules)
+	if err != nil {
+		rl.logger.Errorf("error checking rate limits for key %q, method %q: %v", rateKeyExtension, fullMethod, err)
+		return nil, status.Errorf(codes.Internal, "rate limiter allow: %v", err)
+	}
+
+	violations := lo.FilterMap(results, func(r ruleResult, _ int) (Violation, bool) {
+		return Violation{Rule: r.rule, Key: r.key, RetryAfter: r.RetryAfter}, !r.Allowed
+	})
+	if len(violations) > 0 {
+		return results, rl.exceedErrorFormatter(violations)
+	}
+
+	return results, nil
+}
+
 // allow evaluates all applicable rate limit rules (global and method-level)
-// for the given request context and returns the list of exceeded rules.
+// for the given request context and returns the result of every evaluated rule.
 //
-// It builds a unique storage key per rule and delegates counting to the cache.
-func (rl *RateLimiter) allow(ctx context.Context, rateKeyExtension, fullMethod string, attrs map[string]string, methodRules []Rule) ([]Rule, error) {
-	var exceededRules []Rule
+// It builds a unique storage key per rule and delegates counting to the cache,
+// which counts the request as cost units. A non-empty keySuffix is appended
+// to the rule name in every key, so the same rules can count other events
+// separately. Cache failures are handled according to the failure policy
+// of each rule.
+func (rl *RateLimiter) allow(ctx context.Context, rateKeyExtension, fullMethod, keySuffix string, attrs map[string]string, cost int64, methodRules []Rule) ([]ruleResult, error) {
+	ctx, cancel := rl.cacheContext(ctx)
+	defer cancel()
+
+	results := make([]ruleResult, 0, len(rl.globalLimitRules)+len(methodRules))
 
 	for _, globalRule := range rl.globalLimitRules {
-		fullRateKey := rl.rateKeyFormatter(rl.namespace, rateKeyExtension, fullMethod, globalRule.Name, attrs)
+		fullRateKey := rl.formatRuleKey(globalRule, rateKeyExtension, fullMethod, keySuffix, attrs)
+		results = append(results, ruleResult{rule: globalRule, key: fullRateKey, cost: cost})
+	}
+
+	for _, methodRule := range methodRules {
+		fullRateKey := rl.formatRuleKey(methodRule, rateKeyExtension, fullMethod, keySuffix, attrs)
+		results = append(results, ruleResult{rule: methodRule, key: fullRateKey, cost: cost})
+	}
+
+	if rl.allOrNothing {
+		return rl.allowAllOrNothing(ctx, results)
+	}
+
+	return rl.checkRules(ctx, results)
+}
 
-		ok, err := rl.checkRule(ctx, fullRateKey, globalRule)
+// checkRules evaluates each rule independently and fills in its result.
+//
+// If the cache implements BatchCache, all fixed-window rules
+// are incremented with a single IncrementMulti call.
+func (rl *RateLimiter) checkRules(ctx context.Context, results []ruleResult) ([]ruleResult, error) {
+	batchCache, batched := rl.cache.(BatchCache)
+
+	var batch []int
+	for i := range results {
+		if batched && results[i].rule.Algorithm == AlgorithmFixedWindow {
+			batch = append(batch, i)
+			continue
+		}
+
+		var res quota.Result
+		err := rl.callCache(ctx, func() (err error) {
+			res, err = rl.checkRule(ctx, rl.cache, results[i].key, results[i].rule, results[i].cost)
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to check global rule: %w", err)
+			res, err = rl.handleFailure(ctx, results[i].key, results[i].rule, results[i].cost, err)
 		}
-		if !ok {
-			exceededRules = append(exceededRules, globalRule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check rule %q: %w", results[i].rule.Name, err)
 		}
+		results[i].Result = res
 	}
 
-	for _, methodRule := range methodRules {
-		fullRateKey := rl.rateKeyFormatter(rl.namespace, rateKeyExtension, fullMethod, methodRule.Name, attrs)
+	if len(batch) == 0 {
+		return results, nil
+	}
 
-		ok, err := rl.checkRule(ctx, fullRateKey, methodRule)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check method rule: %w", err)
-		}
-		if !ok {
-			exceededRules = append(exceededRules, methodRule)
+	counters := lo.Map(batch, func(i int, _ int) quota.Counter {
+		return quota.Counter{Key: results[i].key, Window: results[i].rule.Window, Limit: int64(results[i].rule.Limit), Cost: results[i].cost}
+	})
+
+	var res []quota.Result
+	err := rl.callCache(ctx, func() (err error) {
+		res, err = batchCache.IncrementMulti(ctx, counters)
+		return err
+	})
+	if err == nil && len(res) != len(batch) {
+		err = fmt.Errorf("got %d results for %d counters", len(res), len(batch))
+	}
+	if err != nil {
+		rl.logger.Errorf("batch increment failed for %d keys: %v", len(counters), err)
+		if err = rl.handleFailures(ctx, results, batch, fmt.Errorf("increment multi: %w", err)); err != nil {
+			return nil, err
 		}
+
+		return results, nil
 	}
 
-	return exceededRules, nil
+	for j, i := range batch {
+		results[i].Result = res[j]
+	}
+
+	return results, nil
 }
 
-// checkRule increments the counter for the given rule and returns
-// whether the request is allowed within the configured limit.
+// allowAllOrNothing checks and increments all rules in a single atomic
+// cache operation. If any of them is exceeded, nothing is incremented.
 //
-// It relies on the cache to provide atomic fixed-window semantics.
-func (rl *RateLimiter) checkRule(ctx context.Context, fullRateKey string, rule Rule) (bool, error) {
-	count, err := rl.cache.Increment(ctx, fullRateKey, rule.Window)
+// Only fixed-window rules can be rolled into one operation: other
+// algorithms consume quota as they are checked, so requests checked
+// against them fail with ErrAllOrNothingNotSupported.
+func (rl *RateLimiter) allowAllOrNothing(ctx context.Context, results []ruleResult) ([]ruleResult, error) {
+	atomicCache, ok := rl.cache.(AtomicCache)
+	if !ok {
+		return nil, ErrAllOrNothingNotSupported
+	}
+
+	if r, found := lo.Find(results, func(r ruleResult) bool { return r.rule.Algorithm != AlgorithmFixedWindow }); found {
+		return nil, fmt.Errorf("rule %q is not a fixed-window rule: %w", r.rule.Name, ErrAllOrNothingNotSupported)
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	counters := lo.Map(results, func(r ruleResult, _ int) quota.Counter {
+		return quota.Counter{Key: r.key, Window: r.rule.Window, Limit: int64(r.rule.Limit), Cost: r.cost}
+	})
+
+	var res []quota.Result
+	err := rl.callCache(ctx, func() (err error) {
+		res, err = atomicCache.IncrementAll(ctx, counters)
+		return err
+	})
+	if err == nil && len(res) != len(results) {
+		err = fmt.Errorf("got %d results for %d counters", len(res), len(results))
+	}
 	if err != nil {
-		rl.logger.Errorf("increment failed for key %q: %v", fullRateKey, err)
-		return false, fmt.Errorf("increment: %w", err)
+		rl.logger.Errorf("atomic increment failed for %d keys: %v", len(counters), err)
+
+		// При сбое кэша правила проверяются по отдельности, без гарантии атомарности
+		if err = rl.handleFailures(ctx, results, lo.Range(len(results)), fmt.Errorf("increment all: %w", err)); err != nil {
+			return nil, err
+		}
+	} else {
+		for i := range results {
+			results[i].Result = res[i]
+		}
 	}
 
-	if count > int64(rule.Limit) {
-		return false, nil
+	return results, nil
+}
+
+// formatRuleKey builds the storage key of the given rule.
+//
+// The rule scope, when set, replaces the method name, and the rate key
+// extension and attributes are narrowed down by the rule key selection.
+// The key suffix is appended to the rule name.
+func (rl *RateLimiter) formatRuleKey(rule Rule, rateKeyExtension, fullMethod, keySuffix string, attrs map[string]string) string {
+	if rule.Scope != "" {
+		fullMethod = rule.Scope
 	}
 
-	return true, nil
+	ruleExtension, ruleAttrs := selectRuleKey(rule, rateKeyExtension, attrs)
+
+	return rl.rateKeyFormatter(rl.namespace, ruleExtension, fullMethod, rule.Name+keySuffix, ruleAttrs)
+}
+
+// selectRuleKey returns the rate key extension and attributes
+// the given rule counts along, as selected by its Key.
+//
+// Without a key selection, the rule uses all of them. Excluded
+// extension is returned as an empty string.
+func selectRuleKey(rule Rule, rateKeyExtension string, attrs map[string]string) (string, map[string]string) {
+	if rule.Key == nil {
+		return rateKeyExtension, attrs
+	}
+
+	if !rule.Key.Extension {
+		rateKeyExtension = ""
+	}
+
+	return rateKeyExtension, lo.PickByKeys(attrs, rule.Key.RateKeys)
+}
+
+// handleFailures applies the failure policy of every rule at the given
+// indexes after a multi-key cache call covering all of them failed.
+func (rl *RateLimiter) handleFailures(ctx context.Context, results []ruleResult, indexes []int, cause error) error {
+	for _, i := range indexes {
+		res, err := rl.handleFailure(ctx, results[i].key, results[i].rule, results[i].cost, cause)
+		if err != nil {
+			return fmt.Errorf("failed to check rule %q: %w", results[i].rule.Name, err)
+		}
+		results[i].Result = res
+	}
+
+	return nil
 }
 
 // extractRateKeyAttrs extracts rate key attributes from a protobuf message.
@@ -185,36 +356,177 @@ func (rl *RateLimiter) getMethodRules() map[string][]Rule {
 	return rl.methodRules
 }
 
-// loadMethodRules scans all registered protobuf files and extracts
-// rate limiting rules defined via the `rules` method option.
+// loadMethodRules loads the rules and costs of all methods
+// registered in the global protobuf registry.
 //
 // The result is cached for subsequent lookups.
 func (rl *RateLimiter) loadMethodRules() {
-	files := protoregistry.GlobalFiles
+	rl.methodRules, rl.methodCosts = rl.collectMethodRules(protoregistry.GlobalFiles)
+}
+
+// collectMethodRules scans the protobuf files of the given registry and
+// extracts rate limiting rules defined via the `file_rules`, `service_rules`
+// and `rules` options, along with method costs set by the `cost` option.
+//
+// File rules apply to every method of the file and service rules to every
+// method of the service. A rule redefined with the same name at a narrower
+// level replaces the inherited one. Methods with `skip_inherited_rules`
+// use their own rules only. Rules with an invalid window are logged
+// here and fail the requests checked against them with ErrInvalidWindow.
+func (rl *RateLimiter) collectMethodRules(files *protoregistry.Files) (map[string][]Rule, map[string]int64) {
 	rulesMap := make(map[string][]Rule)
+	costsMap := make(map[string]int64)
 
 	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		fileRules := rulesOption(fd.Options(), ratelimiterpb.E_FileRules)
+
 		for i := 0; i < fd.Services().Len(); i++ {
 			service := fd.Services().Get(i)
+			serviceRules := mergeRules(fileRules, rulesOption(service.Options(), ratelimiterpb.E_ServiceRules))
 
 			for j := 0; j < service.Methods().Len(); j++ {
 				method := service.Methods().Get(j)
 				fullMethodName := fmt.Sprintf("/%s/%s", service.FullName(), method.Name())
 
-				options := method.Options().(*descriptorpb.MethodOptions)
-				if options == nil || !proto.HasExtension(options, ratelimiterpb.E_Rules) {
+				inherited := serviceRules
+				if options, ok := method.Options().(*descriptorpb.MethodOptions); ok && options != nil {
+					if proto.GetExtension(options, ratelimiterpb.E_SkipInheritedRules).(bool) {
+						inherited = nil
+					}
+					// Стоимость нужна и методам без собственных правил, их всё равно проверяют глобальные
+					if cost := proto.GetExtension(options, ratelimiterpb.E_Cost).(int32); cost > 0 {
+						costsMap[fullMethodName] = int64(cost)
+					}
+				}
+
+				rules := mergeRules(inherited, rulesOption(method.Options(), ratelimiterpb.E_Rules))
+				if len(rules) == 0 {
 					continue
 				}
 
-				extension := proto.GetExtension(options, ratelimiterpb.E_Rules)
-				if rulesSlice, ok := extension.([]*ratelimiterpb.Rule); ok {
-					rulesMap[fullMethodName] = RateLimitRulesToModel(rulesSlice)
+				// Правило с некорректным окном не отбрасываем: без него метод остался бы без ограничений
+				for _, rule := range rules {
+					if err := checkWindow(rule); err != nil {
+						rl.logger.Errorf("method %q: %v, its requests will fail", fullMethodName, err)
+					}
 				}
+
+				rulesMap[fullMethodName] = rules
 			}
 		}
 
 		return true
 	})
 
-	rl.methodRules = rulesMap
+	rl.validateScopes(rulesMap)
+
+	return rulesMap, costsMap
+}
+
+// validateScopes checks that rules sharing a scope and a name,
+// and therefore one counter, are defined consistently.
+//
+// Methods are visited in lexicographic order and the first definition
+// wins: conflicting definitions are logged and replaced with it.
+func (rl *RateLimiter) validateScopes(rulesMap map[string][]Rule) {
+	type (
+		scopedRuleID struct {
+			scope, name string
+		}
+		scopedRule struct {
+			rule   Rule
+			method string
+		}
+	)
+
+	first := make(map[scopedRuleID]scopedRule)
+
+	methods := lo.Keys(rulesMap)
+	slices.Sort(methods)
+
+	for _, method := range methods {
+		rules := rulesMap[method]
+
+		for i, rule := range rules {
+			if rule.Scope == "" {
+				continue
+			}
+
+			id := scopedRuleID{scope: rule.Scope, name: rule.Name}
+			defined, ok := first[id]
+			if !ok {
+				first[id] = scopedRule{rule: rule, method: method}
+				continue
+			}
+
+			if sameCounter(defined.rule, rule) {
+				continue
+			}
+
+			rl.logger.Errorf(
+				"rule %q in scope %q of method %q conflicts with its definition in method %q, using the latter",
+				rule.Name, rule.Scope, method, defined.method,
+			)
+
+			// Копируем слайс, чтобы не изменить правила, унаследованные другими методами
+			rules = slices.Clone(rules)
+			rules[i] = defined.rule
+			rulesMap[method] = rules
+		}
+	}
+}
+
+// sameCounter reports whether two rules sharing a scope and a name
+// count in the same way: same limit, window, algorithm, burst
+// and key selection.
+func sameCounter(a, b Rule) bool {
+	return a.Limit == b.Limit &&
+		a.Window == b.Window &&
+		a.Algorithm == b.Algorithm &&
+		a.Burst == b.Burst &&
+		sameRuleKey(a.Key, b.Key)
+}
+
+// sameRuleKey reports whether two key selections select the same parts.
+// The order of the selected rate keys does not matter.
+func sameRuleKey(a, b *RuleKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Extension == b.Extension &&
+		lo.ElementsMatch(lo.Uniq(a.RateKeys), lo.Uniq(b.RateKeys))
+}
+
+// rulesOption returns the rules stored in the given repeated Rule
+// extension of descriptor options, or nil if it is not set.
+func rulesOption(options proto.Message, extension protoreflect.ExtensionType) []Rule {
+	if options == nil || !proto.HasExtension(options, extension) {
+		return nil
+	}
+
+	rulesSlice, ok := proto.GetExtension(options, extension).([]*ratelimiterpb.Rule)
+	if !ok {
+		return nil
+	}
+
+	return RateLimitRulesToModel(rulesSlice)
+}
+
+// mergeRules returns the inherited rules followed by the own rules.
+//
+// Inherited rules whose name is redefined by an own rule are dropped.
+func mergeRules(inherited, own []Rule) []Rule {
+	if len(inherited) == 0 {
+		return own
+	}
+
+	names := lo.SliceToMap(own, func(r Rule) (string, struct{}) {
+		return r.Name, struct{}{}
+	})
+
+	return append(lo.Reject(inherited, func(r Rule, _ int) bool {
+		_, ok := names[r.Name]
+		return ok
+	}), own...)
 }
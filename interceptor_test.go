@@ -0,0 +1,324 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	ratelimiterpb "github.com/murouse/rate-limiter/github.com/murouse/rate-limiter"
+	"github.com/murouse/rate-limiter/quota"
+)
+
+// TestAllOrNothingRejectsOtherAlgorithms checks that all-or-nothing mode
+// refuses rules it cannot roll back and consumes no fixed-window quota.
+func TestAllOrNothingRejectsOtherAlgorithms(t *testing.T) {
+	fixed := Rule{Name: "fixed", Limit: 1, Window: time.Minute}
+	bucket := Rule{Name: "bucket", Limit: 1, Window: time.Minute, Algorithm: AlgorithmTokenBucket}
+
+	rl := New(WithAllOrNothing(true), WithGlobalLimitRules([]Rule{fixed, bucket}))
+	t.Cleanup(func() { _ = rl.Close() })
+
+	for i := 0; i < 2; i++ {
+		if err := callUnary(rl, "/test.Service/Method"); status.Code(err) != codes.Internal {
+			t.Fatalf("call #%d: got %v, want Internal", i+1, err)
+		}
+	}
+
+	// Отклонённые запросы не должны были израсходовать квоту fixed-window правила
+	rl.globalLimitRules = []Rule{fixed}
+	if err := callUnary(rl, "/test.Service/Method"); err != nil {
+		t.Fatalf("fixed-window only: %v", err)
+	}
+}
+
+// crossSlotCache refuses every atomic operation
+// the way the Redis adapter does on Redis Cluster.
+type crossSlotCache struct {
+	stubCache
+}
+
+func (crossSlotCache) IncrementAll(context.Context, []quota.Counter) ([]quota.Result, error) {
+	return nil, fmt.Errorf("cross slot: %w", errors.ErrUnsupported)
+}
+
+// TestAllOrNothingConfigErrorBypassesFailurePolicy checks that a cache
+// refusing the rules of a request is not treated as an outage.
+func TestAllOrNothingConfigErrorBypassesFailurePolicy(t *testing.T) {
+	cache := crossSlotCache{stubCache{fn: func(context.Context) error { return nil }}}
+	rl := New(
+		WithCache(cache),
+		WithAllOrNothing(true),
+		WithFailurePolicy(FailurePolicyFailOpen),
+		WithGlobalLimitRules([]Rule{
+			{Name: "per_minute", Limit: 10, Window: time.Minute},
+			{Name: "per_hour", Limit: 100, Window: time.Hour},
+		}),
+	)
+	t.Cleanup(func() { _ = rl.Close() })
+
+	if err := callUnary(rl, "/test.Service/Method"); status.Code(err) != codes.Internal {
+		t.Fatalf("got %v, want Internal", err)
+	}
+}
+
+// recordingLogger records the messages logged as errors.
+type recordingLogger struct {
+	errors []string
+}
+
+func (l *recordingLogger) Debugf(string, ...any) {}
+func (l *recordingLogger) Infof(string, ...any)  {}
+func (l *recordingLogger) Warnf(string, ...any)  {}
+
+func (l *recordingLogger) Errorf(msg string, args ...any) {
+	l.errors = append(l.errors, fmt.Sprintf(msg, args...))
+}
+
+func TestValidateScopes(t *testing.T) {
+	base := Rule{Name: "auth", Limit: 10, Window: time.Hour, Scope: "auth", Key: &RuleKey{RateKeys: []string{"phone", "ip"}}}
+
+	tests := []struct {
+		name         string
+		other        func(r Rule) Rule
+		wantConflict bool
+	}{
+		{name: "same definition", other: func(r Rule) Rule { return r }},
+		{name: "rate keys in another order", other: func(r Rule) Rule {
+			r.Key = &RuleKey{RateKeys: []string{"ip", "phone"}}
+			return r
+		}},
+		{name: "different limit", wantConflict: true, other: func(r Rule) Rule {
+			r.Limit = 20
+			return r
+		}},
+		{name: "different rate keys", wantConflict: true, other: func(r Rule) Rule {
+			r.Key = &RuleKey{RateKeys: []string{"phone"}}
+			return r
+		}},
+		{name: "extension selected", wantConflict: true, other: func(r Rule) Rule {
+			r.Key = &RuleKey{RateKeys: []string{"phone", "ip"}, Extension: true}
+			return r
+		}},
+		{name: "no key selection", wantConflict: true, other: func(r Rule) Rule {
+			r.Key = nil
+			return r
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			rl := New(WithLogger(logger))
+			t.Cleanup(func() { _ = rl.Close() })
+
+			other := tt.other(base)
+			rulesMap := map[string][]Rule{
+				"/test.Auth/SendCode":   {base},
+				"/test.Auth/VerifyCode": {other},
+			}
+			rl.validateScopes(rulesMap)
+
+			if conflict := len(logger.errors) > 0; conflict != tt.wantConflict {
+				t.Fatalf("conflict logged = %t (%v), want %t", conflict, logger.errors, tt.wantConflict)
+			}
+
+			// При конфликте второй метод использует определение первого
+			want := other
+			if tt.wantConflict {
+				want = base
+			}
+			if got := rulesMap["/test.Auth/VerifyCode"][0]; !reflect.DeepEqual(got, want) {
+				t.Fatalf("VerifyCode rule = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFormatRuleKeyScope(t *testing.T) {
+	rl := New(WithNamespace("app"))
+	t.Cleanup(func() { _ = rl.Close() })
+
+	attrs := map[string]string{"phone": "79998887766", "ip": "10.0.0.1"}
+	scoped := Rule{Name: "auth", Scope: "auth", Key: &RuleKey{RateKeys: []string{"phone"}}}
+
+	sendCode := rl.formatRuleKey(scoped, "42", "/test.Auth/SendCode", "", attrs)
+	verifyCode := rl.formatRuleKey(scoped, "42", "/test.Auth/VerifyCode", "", attrs)
+	if sendCode != verifyCode {
+		t.Fatalf("scoped keys differ between methods: %q and %q", sendCode, verifyCode)
+	}
+	if want := "rate-limiter:{app::auth:phone=79998887766}:auth"; sendCode != want {
+		t.Fatalf("scoped key = %q, want %q", sendCode, want)
+	}
+
+	unscoped := scoped
+	unscoped.Scope = ""
+	if key := rl.formatRuleKey(unscoped, "42", "/test.Auth/SendCode", "", attrs); key == sendCode {
+		t.Fatalf("unscoped key %q equals the scoped one", key)
+	}
+}
+
+// rulesTestFiles builds a registry with one file carrying `file_rules`,
+// a service with `service_rules` and methods overriding or skipping them.
+func rulesTestFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+
+	rules := func(rs ...*ratelimiterpb.Rule) []*ratelimiterpb.Rule { return rs }
+	rule := func(name string, limit int32) *ratelimiterpb.Rule {
+		return &ratelimiterpb.Rule{Name: name, Limit: limit, Window: durationpb.New(time.Minute)}
+	}
+
+	fileOptions := &descriptorpb.FileOptions{}
+	proto.SetExtension(fileOptions, ratelimiterpb.E_FileRules, rules(rule("shared", 1), rule("file", 10)))
+
+	serviceOptions := &descriptorpb.ServiceOptions{}
+	proto.SetExtension(serviceOptions, ratelimiterpb.E_ServiceRules, rules(rule("service", 20), rule("shared", 2)))
+
+	methodOptions := func(skip bool, cost int32, rs ...*ratelimiterpb.Rule) *descriptorpb.MethodOptions {
+		options := &descriptorpb.MethodOptions{}
+		if len(rs) > 0 {
+			proto.SetExtension(options, ratelimiterpb.E_Rules, rs)
+		}
+		if skip {
+			proto.SetExtension(options, ratelimiterpb.E_SkipInheritedRules, true)
+		}
+		if cost > 0 {
+			proto.SetExtension(options, ratelimiterpb.E_Cost, cost)
+		}
+		return options
+	}
+
+	method := func(name string, options *descriptorpb.MethodOptions) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(name),
+			InputType:  proto.String(".rules.test.Empty"),
+			OutputType: proto.String(".rules.test.Empty"),
+			Options:    options,
+		}
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("rules_test.proto"),
+		Package:     proto.String("rules.test"),
+		Syntax:      proto.String("proto3"),
+		Options:     fileOptions,
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Empty")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name:    proto.String("Service"),
+				Options: serviceOptions,
+				Method: []*descriptorpb.MethodDescriptorProto{
+					method("Inherited", nil),
+					method("Own", methodOptions(false, 0, rule("method", 5))),
+					method("Override", methodOptions(false, 0, rule("shared", 3))),
+					method("Skip", methodOptions(true, 0, rule("method", 5))),
+					method("SkipAll", methodOptions(true, 4)),
+					method("InvalidWindow", methodOptions(true, 0, &ratelimiterpb.Rule{
+						Name:      "gcra",
+						Limit:     5,
+						Algorithm: ratelimiterpb.Algorithm_ALGORITHM_GCRA,
+					})),
+				},
+			},
+			{
+				Name:   proto.String("Bare"),
+				Method: []*descriptorpb.MethodDescriptorProto{method("Inherited", nil)},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("protodesc.NewFile() error = %v", err)
+	}
+
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(file); err != nil {
+		t.Fatalf("RegisterFile() error = %v", err)
+	}
+
+	return files
+}
+
+// TestCollectMethodRules checks how file, service and method rules
+// are inherited, overridden by name and skipped.
+func TestCollectMethodRules(t *testing.T) {
+	rule := func(name string, limit int) Rule {
+		return Rule{Name: name, Limit: limit, Window: time.Minute}
+	}
+
+	logger := &recordingLogger{}
+	rl := New(WithLogger(logger))
+	t.Cleanup(func() { _ = rl.Close() })
+
+	rules, costs := rl.collectMethodRules(rulesTestFiles(t))
+
+	tests := []struct {
+		name   string
+		method string
+		want   []Rule
+	}{
+		{
+			name:   "file rules only",
+			method: "/rules.test.Bare/Inherited",
+			want:   []Rule{rule("shared", 1), rule("file", 10)},
+		},
+		{
+			name:   "service rule overrides file rule",
+			method: "/rules.test.Service/Inherited",
+			want:   []Rule{rule("file", 10), rule("service", 20), rule("shared", 2)},
+		},
+		{
+			name:   "method rules follow inherited rules",
+			method: "/rules.test.Service/Own",
+			want:   []Rule{rule("file", 10), rule("service", 20), rule("shared", 2), rule("method", 5)},
+		},
+		{
+			name:   "method rule overrides service rule",
+			method: "/rules.test.Service/Override",
+			want:   []Rule{rule("file", 10), rule("service", 20), rule("shared", 3)},
+		},
+		{
+			name:   "skip inherited rules",
+			method: "/rules.test.Service/Skip",
+			want:   []Rule{rule("method", 5)},
+		},
+		{
+			name:   "skip without own rules",
+			method: "/rules.test.Service/SkipAll",
+			want:   nil,
+		},
+		{
+			name:   "invalid window kept",
+			method: "/rules.test.Service/InvalidWindow",
+			want:   []Rule{{Name: "gcra", Limit: 5, Algorithm: AlgorithmGCRA}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules[tt.method]; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("rules[%q] = %+v, want %+v", tt.method, got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := rules["/rules.test.Service/SkipAll"]; ok {
+		t.Fatal("method without rules must not be listed")
+	}
+	if want := map[string]int64{"/rules.test.Service/SkipAll": 4}; !reflect.DeepEqual(costs, want) {
+		t.Fatalf("costs = %v, want %v", costs, want)
+	}
+	if len(logger.errors) != 1 || !strings.Contains(logger.errors[0], "InvalidWindow") {
+		t.Fatalf("logged errors = %q, want one about the invalid window", logger.errors)
+	}
+}
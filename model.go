@@ -8,11 +8,88 @@ import (
 	ratelimiterpb "github.com/murouse/rate-limiter/github.com/murouse/rate-limiter"
 )
 
-// Rule describes a single fixed-window rate limiting rule.
+// Algorithm selects the strategy used to enforce a Rule.
+type Algorithm int
+
+const (
+	// AlgorithmFixedWindow counts requests in fixed windows
+	// whose TTL is set on the first request and never extended.
+	AlgorithmFixedWindow Algorithm = iota
+	// AlgorithmTokenBucket refills Limit tokens per Window
+	// into a bucket holding at most Burst tokens.
+	AlgorithmTokenBucket
+	// AlgorithmSlidingWindow approximates a sliding window by adding
+	// the previous fixed window count, weighted by its overlap with
+	// the sliding window, to the current window count.
+	AlgorithmSlidingWindow
+	// AlgorithmGCRA implements the generic cell rate algorithm,
+	// admitting Limit requests per Window with bursts of up to Burst
+	// requests while storing a single timestamp per key.
+	AlgorithmGCRA
+	// AlgorithmSlidingLog records the timestamp of every allowed request
+	// and admits a request only if fewer than Limit requests were allowed
+	// during the last Window. Exact, intended for low limits.
+	AlgorithmSlidingLog
+)
+
+// FailurePolicy decides how a rule is enforced when the cache fails.
+type FailurePolicy int
+
+const (
+	// FailurePolicyUnspecified makes a rule inherit the policy
+	// configured with WithFailurePolicy.
+	FailurePolicyUnspecified FailurePolicy = iota
+	// FailurePolicyFailClosed rejects the request with codes.Internal.
+	FailurePolicyFailClosed
+	// FailurePolicyFailOpen allows the request as if the rule was not exceeded.
+	FailurePolicyFailOpen
+	// FailurePolicyLocalFallback evaluates the rule against a local
+	// in-memory cache, with limits scaled by WithLocalFallbackScale.
+	FailurePolicyLocalFallback
+)
+
+// Rule describes a single rate limiting rule.
 type Rule struct {
 	Name   string
 	Limit  int
 	Window time.Duration
+
+	// Algorithm selects the limiting strategy.
+	// Defaults to AlgorithmFixedWindow.
+	Algorithm Algorithm
+	// Burst is the token bucket capacity and the GCRA burst size.
+	// Defaults to Limit when zero. Ignored by other algorithms.
+	Burst int
+	// FailurePolicy overrides the limiter's failure policy for this rule.
+	FailurePolicy FailurePolicy
+	// Key selects the parts of the rate key this rule counts along.
+	// Nil means every rate key attribute and the rate key extension.
+	//
+	// Rules of one method selecting different parts, or using different
+	// scopes, are stored under different Redis Cluster hash slots and
+	// cannot be used in all-or-nothing mode on Redis Cluster.
+	Key *RuleKey
+	// Scope replaces the method name in the key, so rules with the same
+	// Name and Scope share one counter across methods.
+	Scope string
+}
+
+// RuleKey selects the parts of the rate key a rule counts along,
+// so rules of one method can count along different dimensions.
+type RuleKey struct {
+	// RateKeys lists the `rate_key` aliases included in the key.
+	RateKeys []string
+	// Extension includes the rate key extension (e.g. user ID) in the key.
+	Extension bool
+}
+
+// Violation describes a single rule exceeded by a request.
+type Violation struct {
+	Rule Rule
+	// Key is the full storage key the rule was evaluated against.
+	Key string
+	// RetryAfter is the time until the rule would allow the request again.
+	RetryAfter time.Duration
 }
 
 // RateLimitRulesToModel converts protobuf Rule definitions
@@ -20,9 +97,63 @@ type Rule struct {
 func RateLimitRulesToModel(rs []*ratelimiterpb.Rule) []Rule {
 	return lo.Map(rs, func(r *ratelimiterpb.Rule, _ int) Rule {
 		return Rule{
-			Name:   r.Name,
-			Limit:  int(r.Limit),
-			Window: r.Window.AsDuration(),
+			Name:      r.Name,
+			Limit:     int(r.Limit),
+			Window:    r.Window.AsDuration(),
+			Algorithm: algorithmToModel(r.Algorithm),
+			Burst:     int(r.Burst),
+
+			FailurePolicy: failurePolicyToModel(r.FailurePolicy),
+			Key:           ruleKeyToModel(r.Key),
+			Scope:         r.Scope,
 		}
 	})
 }
+
+// algorithmToModel converts a protobuf Algorithm into its model counterpart.
+//
+// Unknown values fall back to AlgorithmFixedWindow.
+func algorithmToModel(a ratelimiterpb.Algorithm) Algorithm {
+	switch a {
+	case ratelimiterpb.Algorithm_ALGORITHM_TOKEN_BUCKET:
+		return AlgorithmTokenBucket
+	case ratelimiterpb.Algorithm_ALGORITHM_SLIDING_WINDOW:
+		return AlgorithmSlidingWindow
+	case ratelimiterpb.Algorithm_ALGORITHM_GCRA:
+		return AlgorithmGCRA
+	case ratelimiterpb.Algorithm_ALGORITHM_SLIDING_LOG:
+		return AlgorithmSlidingLog
+	default:
+		return AlgorithmFixedWindow
+	}
+}
+
+// ruleKeyToModel converts a protobuf RuleKey into its model counterpart.
+//
+// A missing key selection is converted to nil.
+func ruleKeyToModel(k *ratelimiterpb.RuleKey) *RuleKey {
+	if k == nil {
+		return nil
+	}
+
+	return &RuleKey{
+		RateKeys:  k.RateKeys,
+		Extension: k.Extension,
+	}
+}
+
+// failurePolicyToModel converts a protobuf FailurePolicy into its model counterpart.
+//
+// Unknown values fall back to FailurePolicyUnspecified.
+func failurePolicyToModel(p ratelimiterpb.FailurePolicy) FailurePolicy {
+	switch p {
+	case ratelimiterpb.FailurePolicy_FAILURE_POLICY_FAIL_CLOSED:
+		return FailurePolicyFailClosed
+	case ratelimiterpb.FailurePolicy_FAILURE_POLICY_FAIL_OPEN:
+		return FailurePolicyFailOpen
+	case ratelimiterpb.FailurePolicy_FAILURE_POLICY_LOCAL_FALLBACK:
+		return FailurePolicyLocalFallback
+	default:
+		return FailurePolicyUnspecified
+	}
+}
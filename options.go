@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 // Option configures RateLimiter.
@@ -33,6 +36,29 @@ func WithRateKeyExtender(rateKeyExtender rateKeyExtenderFunc) Option {
 	}
 }
 
+// WithStreamRateKeyExtender overrides the rate key extension logic
+// used by StreamServerInterceptor.
+//
+// It is the streaming counterpart of WithRateKeyExtender.
+func WithStreamRateKeyExtender(streamRateKeyExtender streamRateKeyExtenderFunc) Option {
+	return func(rl *RateLimiter) {
+		rl.streamRateKeyExtender = streamRateKeyExtender
+	}
+}
+
+// WithStreamMessageLimiting enables counting of every message received
+// on a stream, in addition to the check performed when the stream is opened.
+//
+// Rate key attributes are extracted from each received message.
+// Messages are counted under the rule name suffixed with ":messages",
+// so each rule allows its limit of stream opens and, separately,
+// its limit of messages.
+func WithStreamMessageLimiting(enabled bool) Option {
+	return func(rl *RateLimiter) {
+		rl.streamMessageLimiting = enabled
+	}
+}
+
 // WithNamespace sets a namespace prefix for all generated storage keys.
 //
 // Useful when sharing the same cache across multiple services.
@@ -51,7 +77,9 @@ func WithGlobalLimitRules(rules []Rule) Option {
 
 // WithRateKeyFormatter overrides the storage key formatting logic.
 //
-// Intended for advanced customization of key structure.
+// Intended for advanced customization of key structure. When using
+// Redis Cluster, keys produced for one request should share a hash tag
+// ({...}) so batched and all-or-nothing operations hit a single slot.
 func WithRateKeyFormatter(rateKeyFormatter rateKeyFormatterFunc) Option {
 	return func(rl *RateLimiter) {
 		rl.rateKeyFormatter = rateKeyFormatter
@@ -65,6 +93,78 @@ func WithLogger(logger Logger) Option {
 	}
 }
 
+// WithAllOrNothing enables all-or-nothing quota consumption.
+//
+// The fixed-window rules of a request are checked and incremented
+// atomically: if any of them is exceeded, no counter is incremented,
+// so rejected requests consume no quota.
+//
+// The configured cache must implement AtomicCache. Other algorithms
+// consume quota as they are checked and cannot be rolled back, so
+// requests checked against a rule using one of them fail with
+// ErrAllOrNothingNotSupported (codes.Internal).
+func WithAllOrNothing(enabled bool) Option {
+	return func(rl *RateLimiter) {
+		rl.allOrNothing = enabled
+	}
+}
+
+// WithRateLimitHeaders controls whether UnaryServerInterceptor reports
+// the state of the most restrictive rule in response metadata.
+//
+// Enabled by default. See setRateLimitHeaders for the header format.
+func WithRateLimitHeaders(enabled bool) Option {
+	return func(rl *RateLimiter) {
+		rl.rateLimitHeaders = enabled
+	}
+}
+
+// WithFailurePolicy sets how rules are enforced when the cache fails
+// or does not answer within the cache timeout.
+//
+// Defaults to FailurePolicyFailClosed. Rules may override the policy
+// with their own FailurePolicy.
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(rl *RateLimiter) {
+		rl.failurePolicy = policy
+	}
+}
+
+// WithLocalFallbackScale sets the factor applied to rule limits
+// evaluated against the local cache under FailurePolicyLocalFallback.
+//
+// Defaults to 1. With N instances sharing one cache, 1/N keeps
+// the combined limit close to the configured one.
+func WithLocalFallbackScale(scale float64) Option {
+	return func(rl *RateLimiter) {
+		rl.localFallbackScale = scale
+	}
+}
+
+// WithCacheTimeout bounds the cache calls made for one request.
+//
+// The cache calls then no longer depend on the request context:
+// they are neither canceled with the request nor limited by its deadline.
+// A non-positive timeout (the default) passes the request context as is.
+func WithCacheTimeout(timeout time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.cacheTimeout = timeout
+	}
+}
+
+// WithCircuitBreaker wraps every call to the configured cache
+// in a circuit breaker.
+//
+// After consecutive failed or slow calls the circuit opens and cache calls
+// fail immediately with ErrCircuitOpen, which is handled by the failure
+// policy of each rule. State changes are reported through the logger.
+// The local fallback cache is never wrapped.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) Option {
+	return func(rl *RateLimiter) {
+		rl.circuitBreakerConfig = &cfg
+	}
+}
+
 // WithExceedErrorFormatter overrides the error returned
 // when one or more rate limit rules are exceeded.
 func WithExceedErrorFormatter(exceedErrorFormatter exceedErrorFormatterFunc) Option {
@@ -76,8 +176,12 @@ func WithExceedErrorFormatter(exceedErrorFormatter exceedErrorFormatterFunc) Opt
 type rateKeyFormatterFunc func(namespace, rateKeyExtension, fullMethod, ruleName string, attrs map[string]string) string
 
 // defaultRateKeyFormatter builds a deterministic storage key
-// composed of namespace, rate key extension, full method name,
-// rule name, and sorted rate key attributes.
+// composed of namespace, rate key extension, full method name
+// (or rule scope), sorted rate key attributes, and rule name.
+//
+// Everything except the rule name is wrapped in a Redis Cluster hash tag
+// ({...}), so all rule keys of one request hash to the same slot and
+// multi-key scripts do not fail with CROSSSLOT.
 func defaultRateKeyFormatter(namespace, rateKeyExtension, fullMethod, ruleName string, attrs map[string]string) string {
 	// Сортируем ключи attrs для детерминированного порядка
 	keys := lo.Keys(attrs)
@@ -91,22 +195,46 @@ func defaultRateKeyFormatter(namespace, rateKeyExtension, fullMethod, ruleName s
 
 	// Собираем финальный ключ
 	if attrStr != "" {
-		return fmt.Sprintf("rate-limiter:%s:%s:%s:%s:%s", namespace, rateKeyExtension, fullMethod, ruleName, attrStr)
+		return fmt.Sprintf("rate-limiter:{%s:%s:%s:%s}:%s", namespace, rateKeyExtension, fullMethod, attrStr, ruleName)
 	}
 
-	return fmt.Sprintf("rate-limiter:%s:%s:%s:%s", namespace, rateKeyExtension, fullMethod, ruleName)
+	return fmt.Sprintf("rate-limiter:{%s:%s:%s}:%s", namespace, rateKeyExtension, fullMethod, ruleName)
 }
 
-type exceedErrorFormatterFunc func(exceededRules []Rule) error
+type exceedErrorFormatterFunc func(violations []Violation) error
 
 // defaultExceedErrorFormatter returns a ResourceExhausted gRPC error
 // containing the names of exceeded rules.
-func defaultExceedErrorFormatter(exceededRules []Rule) error {
-	msg := strings.Join(lo.Map(exceededRules, func(exceededRule Rule, _ int) string {
-		return exceededRule.Name
+//
+// The status carries google.rpc.RetryInfo with the longest retry delay
+// among the violations, and google.rpc.QuotaFailure with one violation
+// per exceeded rule whose subject is the rate key.
+func defaultExceedErrorFormatter(violations []Violation) error {
+	msg := strings.Join(lo.Map(violations, func(violation Violation, _ int) string {
+		return violation.Rule.Name
 	}), ", ")
 
-	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded: %s", msg)
+	st := status.Newf(codes.ResourceExhausted, "rate limit exceeded: %s", msg)
+
+	retryAfter := lo.MaxBy(violations, func(a, b Violation) bool {
+		return a.RetryAfter > b.RetryAfter
+	}).RetryAfter
+
+	quotaFailure := &errdetails.QuotaFailure{
+		Violations: lo.Map(violations, func(violation Violation, _ int) *errdetails.QuotaFailure_Violation {
+			return &errdetails.QuotaFailure_Violation{
+				Subject:     violation.Key,
+				Description: fmt.Sprintf("rule %q: %d requests per %s", violation.Rule.Name, violation.Rule.Limit, violation.Rule.Window),
+			}
+		}),
+	}
+
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}, quotaFailure)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
 }
 
 type rateKeyExtenderFunc func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo) (string, error)
@@ -0,0 +1,39 @@
+// Package quota defines the outcome of a rate limiting storage operation.
+//
+// It is shared by the rate limiter and Cache implementations
+// so that storage backends do not depend on the limiter itself.
+package quota
+
+import "time"
+
+// Result describes the state of a single limit after a request
+// has been evaluated against it.
+type Result struct {
+	// Allowed reports whether the request fits within the limit.
+	Allowed bool
+	// Remaining is the number of requests still allowed
+	// before the limit is exceeded.
+	Remaining int64
+	// RetryAfter is the time until the limit would allow
+	// the request again. Zero for allowed requests.
+	RetryAfter time.Duration
+	// ResetAfter is the time until the full quota is available again.
+	ResetAfter time.Duration
+}
+
+// Counter describes a fixed-window counter
+// taking part in a multi-key operation.
+type Counter struct {
+	Key    string
+	Window time.Duration
+	Limit  int64
+	// Cost is the amount the counter is incremented by.
+	// Zero is treated as one.
+	Cost int64
+}
+
+// Amount returns the amount the counter is incremented by:
+// its Cost, or one when Cost is not set.
+func (c Counter) Amount() int64 {
+	return max(1, c.Cost)
+}
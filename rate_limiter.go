@@ -1,45 +1,104 @@
 package ratelimiter
 
 import (
+	"errors"
 	"sync"
+	"time"
 
-	"github.com/murouse/rate-limiter/internal/cache"
+	"github.com/murouse/rate-limiter/cache/memory"
 	"github.com/murouse/rate-limiter/internal/logger"
 )
 
-// RateLimiter implements a fixed-window rate limiting middleware for gRPC.
-// The limiter enforces fixed-window semantics.
+// RateLimiter implements a rate limiting middleware for gRPC.
+// Rules use fixed-window semantics unless they select another Algorithm.
 type RateLimiter struct {
-	cache                Cache
-	namespace            string
-	globalLimitRules     []Rule
-	rateKeyExtender      rateKeyExtenderFunc
-	rateKeyFormatter     rateKeyFormatterFunc
-	exceedErrorFormatter exceedErrorFormatterFunc
-	logger               Logger
+	cache                 Cache
+	namespace             string
+	globalLimitRules      []Rule
+	rateKeyExtender       rateKeyExtenderFunc
+	streamRateKeyExtender streamRateKeyExtenderFunc
+	rateKeyFormatter      rateKeyFormatterFunc
+	exceedErrorFormatter  exceedErrorFormatterFunc
+	logger                Logger
+
+	streamMessageLimiting bool
+	rateLimitHeaders      bool
+	allOrNothing          bool
+
+	failurePolicy      FailurePolicy
+	localFallbackScale float64
+	cacheTimeout       time.Duration
+
+	circuitBreakerConfig *CircuitBreakerConfig
+	circuitBreaker       *circuitBreaker
 
 	methodRules     map[string][]Rule
+	methodCosts     map[string]int64
 	methodRulesOnce sync.Once
+
+	// defaultCache is the in-memory cache created by New
+	// when no cache is configured. It is owned and closed by the limiter.
+	defaultCache *memory.Cache
+
+	// fallbackCache is the local cache used by FailurePolicyLocalFallback.
+	// It is created on first use, see getFallbackCache.
+	fallbackCache     *memory.Cache
+	fallbackCacheOnce sync.Once
 }
 
 // New creates a new RateLimiter with default configuration.
 //
 // By default, it uses an in-memory cache, no-op logger,
 // default namespace, and standard key formatting behavior.
+// The default in-memory cache runs a background janitor,
+// which is stopped by Close.
 func New(opts ...Option) *RateLimiter {
 	rl := &RateLimiter{
-		cache:                cache.NewInMemoryCache(),
-		namespace:            "default",
-		globalLimitRules:     nil,
-		rateKeyExtender:      defaultRateKeyExtender,
-		rateKeyFormatter:     defaultRateKeyFormatter,
-		exceedErrorFormatter: defaultExceedErrorFormatter,
-		logger:               logger.NewNoopLogger(),
+		namespace:             "default",
+		globalLimitRules:      nil,
+		rateKeyExtender:       defaultRateKeyExtender,
+		streamRateKeyExtender: defaultStreamRateKeyExtender,
+		rateKeyFormatter:      defaultRateKeyFormatter,
+		exceedErrorFormatter:  defaultExceedErrorFormatter,
+		logger:                logger.NewNoopLogger(),
+		rateLimitHeaders:      true,
+		failurePolicy:         FailurePolicyFailClosed,
+		localFallbackScale:    1,
 	}
 
 	for _, opt := range opts {
 		opt(rl)
 	}
 
+	// Создаём кэш по умолчанию только если он не был передан, чтобы не запускать лишний janitor
+	if rl.cache == nil {
+		rl.defaultCache = memory.New()
+		rl.cache = rl.defaultCache
+	}
+
+	// Circuit breaker создаётся после опций, чтобы использовать итоговый логгер
+	if rl.circuitBreakerConfig != nil {
+		rl.circuitBreaker = newCircuitBreaker(*rl.circuitBreakerConfig, rl.logger)
+	}
+
 	return rl
 }
+
+// Close releases resources owned by the limiter, such as the janitors
+// of the default in-memory cache and of the local fallback cache.
+//
+// Caches passed with WithCache are not closed.
+func (rl *RateLimiter) Close() error {
+	var errs []error
+	if rl.defaultCache != nil {
+		errs = append(errs, rl.defaultCache.Close())
+	}
+
+	// Если резервный кэш ещё не создан, создаём его без janitor, чтобы он оставался пригодным после Close
+	rl.fallbackCacheOnce.Do(func() {
+		rl.fallbackCache = memory.New(memory.WithSweepInterval(0))
+	})
+	errs = append(errs, rl.fallbackCache.Close())
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package ratelimiter
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// streamMessageKeySuffix is appended to the rule name in the keys
+// counting stream messages, so that messages and stream opens are
+// limited separately by the same rules.
+const streamMessageKeySuffix = ":messages"
+
+// StreamServerInterceptor returns a gRPC stream server interceptor
+// that enforces fixed-window rate limiting for incoming streams.
+//
+// Global and per-method rules are evaluated once when the stream is opened.
+// No request message is available at that point, so rate key attributes
+// are empty for this check and the stream costs the method `cost` only.
+//
+// When per-message limiting is enabled (see WithStreamMessageLimiting),
+// every message received by the handler is additionally counted against
+// the same rules, using rate key attributes and cost extracted from the message.
+// Messages are counted under their own keys, so a rule limits stream
+// opens and messages independently. A message that exceeds a limit
+// is rejected from RecvMsg with the configured exceed error.
+func (rl *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+
+		// Извлекаем дополнительный кастомный rate key (например идентификатор пользователя из контекста)
+		rateKeyExtension, err := rl.streamRateKeyExtender(ctx, info)
+		if err != nil {
+			rl.logger.Errorf("cannot extend rate key for stream %q: %v", info.FullMethod, err)
+			return status.Errorf(codes.Internal, "cannot extend rate key: %v", err)
+		}
+		rl.logger.Debugf("rate key extension %q for stream %q", rateKeyExtension, info.FullMethod)
+
+		methodRules := rl.getMethodRules()[info.FullMethod]
+		rl.logger.Debugf("found %d rate limit rules for stream %q", len(methodRules), info.FullMethod)
+
+		if _, err := rl.enforce(ctx, rateKeyExtension, info.FullMethod, "", nil, rl.requestCost(info.FullMethod, nil), methodRules); err != nil {
+			return err
+		}
+
+		if !rl.streamMessageLimiting {
+			return handler(srv, ss)
+		}
+
+		return handler(srv, &rateLimitedServerStream{
+			ServerStream:     ss,
+			rl:               rl,
+			fullMethod:       info.FullMethod,
+			rateKeyExtension: rateKeyExtension,
+			methodRules:      methodRules,
+		})
+	}
+}
+
+// rateLimitedServerStream wraps grpc.ServerStream and counts
+// every received message against the stream's rate limit rules.
+type rateLimitedServerStream struct {
+	grpc.ServerStream
+
+	rl               *RateLimiter
+	fullMethod       string
+	rateKeyExtension string
+	methodRules      []Rule
+}
+
+// RecvMsg receives the next message from the client and checks it
+// against the stream's rate limit rules.
+//
+// If the message exceeds a limit, the exceed error is returned
+// and the message must not be processed by the handler.
+func (s *rateLimitedServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	var (
+		attrs map[string]string
+		msg   proto.Message
+	)
+	if pm, ok := m.(proto.Message); ok {
+		msg = pm
+		attrs = extractRateKeyAttrs(msg)
+	}
+
+	_, err := s.rl.enforce(s.Context(), s.rateKeyExtension, s.fullMethod, streamMessageKeySuffix, attrs, s.rl.requestCost(s.fullMethod, msg), s.methodRules)
+
+	return err
+}
+
+type streamRateKeyExtenderFunc func(ctx context.Context, info *grpc.StreamServerInfo) (string, error)
+
+// defaultStreamRateKeyExtender returns a static rate key extension.
+//
+// It mirrors defaultRateKeyExtender for streaming RPCs.
+func defaultStreamRateKeyExtender(ctx context.Context, info *grpc.StreamServerInfo) (string, error) {
+	return "rate-key-extension", nil
+}
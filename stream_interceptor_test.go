@@ -0,0 +1,154 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fakeServerStream delivers the queued messages from RecvMsg
+// and then fails with err (io.EOF when nil).
+type fakeServerStream struct {
+	grpc.ServerStream
+
+	msgs []proto.Message
+	err  error
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if len(s.msgs) == 0 {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+
+	proto.Merge(m.(proto.Message), s.msgs[0])
+	s.msgs = s.msgs[1:]
+
+	return nil
+}
+
+// callStream opens a stream through the stream interceptor of rl and
+// receives messages until RecvMsg fails. It returns the number of
+// messages received and the error of the call, io.EOF excluded.
+func callStream(rl *RateLimiter, stream *fakeServerStream) (int, error) {
+	var received int
+	err := rl.StreamServerInterceptor()(
+		nil,
+		stream,
+		&grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			for {
+				if err := ss.RecvMsg(dynamicpb.NewMessage(costRequestDescriptor)); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return err
+				}
+				received++
+			}
+		},
+	)
+
+	return received, err
+}
+
+// streamMessages returns n requests costing one unit each.
+func streamMessages(n int) []proto.Message {
+	msgs := make([]proto.Message, n)
+	for i := range msgs {
+		msgs[i] = costRequest(1, 0, 0)
+	}
+
+	return msgs
+}
+
+func TestStreamOpenOnly(t *testing.T) {
+	rl := New(WithGlobalLimitRules([]Rule{{Name: "global", Limit: 2, Window: time.Minute}}))
+	t.Cleanup(func() { _ = rl.Close() })
+
+	for i := 0; i < 2; i++ {
+		received, err := callStream(rl, &fakeServerStream{msgs: streamMessages(5)})
+		if err != nil || received != 5 {
+			t.Fatalf("stream #%d: received %d messages, %v, want 5 and no error", i+1, received, err)
+		}
+	}
+
+	if _, err := callStream(rl, &fakeServerStream{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("stream #3: got %v, want ResourceExhausted", err)
+	}
+}
+
+func TestStreamMessageLimiting(t *testing.T) {
+	newLimiter := func(t *testing.T, limit int) *RateLimiter {
+		rl := New(
+			WithStreamMessageLimiting(true),
+			WithGlobalLimitRules([]Rule{{Name: "global", Limit: limit, Window: time.Minute}}),
+		)
+		t.Cleanup(func() { _ = rl.Close() })
+
+		return rl
+	}
+
+	t.Run("opens and messages count separately", func(t *testing.T) {
+		rl := newLimiter(t, 4)
+
+		// Каждый server-streaming вызов — одно открытие и одно сообщение
+		for i := 0; i < 4; i++ {
+			if received, err := callStream(rl, &fakeServerStream{msgs: streamMessages(1)}); err != nil || received != 1 {
+				t.Fatalf("stream #%d: received %d messages, %v, want 1 and no error", i+1, received, err)
+			}
+		}
+
+		if _, err := callStream(rl, &fakeServerStream{}); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("stream #5: got %v, want ResourceExhausted", err)
+		}
+	})
+
+	t.Run("message over the limit", func(t *testing.T) {
+		rl := newLimiter(t, 3)
+
+		received, err := callStream(rl, &fakeServerStream{msgs: streamMessages(5)})
+		if status.Code(err) != codes.ResourceExhausted || received != 3 {
+			t.Fatalf("received %d messages, %v, want 3 and ResourceExhausted", received, err)
+		}
+	})
+
+	t.Run("message cost", func(t *testing.T) {
+		rl := newLimiter(t, 4)
+
+		msgs := []proto.Message{costRequest(3, 0, 0), costRequest(3, 0, 0)}
+		received, err := callStream(rl, &fakeServerStream{msgs: msgs})
+		if status.Code(err) != codes.ResourceExhausted || received != 1 {
+			t.Fatalf("received %d messages, %v, want 1 and ResourceExhausted", received, err)
+		}
+	})
+
+	t.Run("receive error", func(t *testing.T) {
+		rl := newLimiter(t, 2)
+		recvErr := status.Error(codes.Canceled, "client went away")
+
+		received, err := callStream(rl, &fakeServerStream{msgs: streamMessages(1), err: recvErr})
+		if !errors.Is(err, recvErr) || received != 1 {
+			t.Fatalf("received %d messages, %v, want 1 and the receive error", received, err)
+		}
+
+		// Неудачный приём не был засчитан как сообщение
+		if received, err := callStream(rl, &fakeServerStream{msgs: streamMessages(1)}); err != nil || received != 1 {
+			t.Fatalf("received %d messages, %v, want 1 and no error", received, err)
+		}
+	})
+}